@@ -0,0 +1,132 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+// BatchResult is the response of the job with its index in the batch
+type BatchResult struct {
+	Index int
+	job.Response
+}
+
+type BatchSummary struct {
+	Total     int
+	Succeeded int
+	Failed    int
+	// Canceled is the number of jobs which were not started because the batch was canceled
+	Canceled int
+}
+
+// Batch is a handle of jobs submitted together with ExecuteBatch
+type Batch struct {
+	results   []BatchResult
+	completed chan BatchResult
+	done      chan struct{}
+	cancel    context.CancelFunc
+	failFast  bool
+	summary   BatchSummary
+	mu        sync.Mutex
+}
+
+// ExecuteBatch executes the jobs and returns the handle to collect results.
+// If failFast is set the remaining jobs are canceled on the first error.
+func (l *RateLimiter) ExecuteBatch(jobs []job.Job, failFast bool, opts ...Option) *Batch {
+	// the context of the batch is derived from the context set by options
+	var parent job.Request
+	for _, opt := range opts {
+		opt(&parent)
+	}
+
+	ctx, cancel := context.WithCancel(parent.Context())
+
+	b := &Batch{
+		results:   make([]BatchResult, len(jobs)),
+		completed: make(chan BatchResult, len(jobs)),
+		done:      make(chan struct{}),
+		cancel:    cancel,
+		failFast:  failFast,
+		summary:   BatchSummary{Total: len(jobs)},
+	}
+
+	opts = append(opts, WithContext(ctx))
+
+	var wg sync.WaitGroup
+	wg.Add(len(jobs))
+
+	for i, j := range jobs {
+		ch := l.execute(job.Request{Job: j}, opts)
+
+		go func(i int, ch <-chan job.Response) {
+			defer wg.Done()
+
+			b.add(BatchResult{Index: i, Response: <-ch})
+		}(i, ch)
+	}
+
+	go func() {
+		wg.Wait()
+		cancel()
+
+		close(b.completed)
+		close(b.done)
+	}()
+
+	return b
+}
+
+// Completed returns results in completion order. The channel is closed
+// when all jobs are completed.
+func (b *Batch) Completed() <-chan BatchResult {
+	return b.completed
+}
+
+// Done returns the channel which is closed when all jobs are completed
+func (b *Batch) Done() <-chan struct{} {
+	return b.done
+}
+
+// Cancel fails jobs of the batch which are not started yet
+func (b *Batch) Cancel() {
+	b.cancel()
+}
+
+// Wait waits for all jobs and returns results in submission order
+func (b *Batch) Wait() []BatchResult {
+	<-b.done
+
+	return b.results
+}
+
+// Summary waits for all jobs and returns the number of succeeded, failed and canceled jobs
+func (b *Batch) Summary() BatchSummary {
+	<-b.done
+
+	return b.summary
+}
+
+func (b *Batch) add(result BatchResult) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.results[result.Index] = result
+
+	switch {
+	case result.Error == nil:
+		b.summary.Succeeded++
+	case errors.Is(result.Error, context.Canceled):
+		b.summary.Canceled++
+	default:
+		b.summary.Failed++
+
+		if b.failFast {
+			b.cancel()
+		}
+	}
+
+	b.completed <- result
+}
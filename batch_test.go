@@ -0,0 +1,75 @@
+package limiter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/chatex-com/rate-limiter/pkg/config"
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+func TestExecuteBatch(t *testing.T) {
+	Convey("Results in submission order", t, func() {
+		l := newTestRateLimiter()
+
+		jobs := []job.Job{
+			func() (interface{}, error) {
+				time.Sleep(20 * time.Millisecond)
+				return 0, nil
+			},
+			func() (interface{}, error) {
+				return 1, nil
+			},
+			func() (interface{}, error) {
+				return nil, errors.New("error")
+			},
+		}
+
+		b := l.ExecuteBatch(jobs, false)
+
+		var completed []int
+		for result := range b.Completed() {
+			completed = append(completed, result.Index)
+		}
+		So(completed, ShouldHaveLength, 3)
+		So(completed[2], ShouldEqual, 0)
+
+		results := b.Wait()
+		So(results, ShouldHaveLength, 3)
+		So(results[0].Result, ShouldEqual, 0)
+		So(results[1].Result, ShouldEqual, 1)
+		So(results[2].Error, ShouldBeError)
+
+		So(b.Summary(), ShouldResemble, BatchSummary{Total: 3, Succeeded: 2, Failed: 1})
+	})
+
+	Convey("Fail fast cancels remaining jobs", t, func() {
+		cfg := config.NewConfigWithQuotas([]*config.Quota{
+			config.NewQuota(1, time.Hour),
+		})
+		cfg.Concurrency = 1
+		l, _ := NewRateLimiter(cfg)
+		l.Start()
+
+		// only one job can be executed, remaining jobs are waiting for the quota
+		failed := func() (interface{}, error) {
+			return nil, errors.New("error")
+		}
+		jobs := []job.Job{failed, failed, failed}
+
+		summary := l.ExecuteBatch(jobs, true).Summary()
+
+		So(summary, ShouldResemble, BatchSummary{Total: 3, Failed: 1, Canceled: 2})
+	})
+
+	Convey("Empty batch", t, func() {
+		l := newTestRateLimiter()
+		b := l.ExecuteBatch(nil, false)
+
+		So(b.Wait(), ShouldBeEmpty)
+		So(b.Summary().Total, ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,163 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/chatex-com/rate-limiter/internal/limiter"
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+type bookingState int
+
+const (
+	bookingPending bookingState = iota
+	bookingScheduled
+	bookingUsed
+	bookingCanceled
+)
+
+// Booking is quota slots booked in advance at the time. The slots are
+// unavailable to other jobs till the booking is canceled.
+type Booking struct {
+	at          time.Time
+	key         string
+	path        []string
+	weight      uint
+	reservation *limiter.Reservation
+	state       bookingState
+	stateLock   sync.Mutex
+	cancel      func()
+}
+
+// At returns the time of the booked slots
+func (b *Booking) At() time.Time {
+	return b.at
+}
+
+// Cancel returns booked slots back to quotas. The job scheduled on the booking
+// is failed with job.ErrBookingCanceled. It returns false if the job was already
+// started or the booking was canceled before.
+func (b *Booking) Cancel() bool {
+	b.stateLock.Lock()
+	defer b.stateLock.Unlock()
+
+	if b.state == bookingUsed || b.state == bookingCanceled {
+		return false
+	}
+
+	b.reservation.Refund()
+
+	if b.state == bookingScheduled {
+		b.cancel()
+	}
+
+	b.state = bookingCanceled
+
+	return true
+}
+
+// ReserveAt books slots at the time in every time window quota of the limiter
+// and of the key. Only WithKey, WithPath and WithWeight options are applied.
+// Concurrency quotas can't be booked: their slots are taken when the job is started.
+// It fails with *job.RateLimitError if slots at the time are already taken.
+func (l *RateLimiter) ReserveAt(t time.Time, opts ...Option) (*Booking, error) {
+	r := job.Request{}
+
+	for _, opt := range opts {
+		opt(&r)
+	}
+
+	if !l.fits(r) {
+		return nil, job.ErrWeightExceedsCapacity
+	}
+
+	reservation, exhausted := l.quotas.BookPath(t, r.Key, r.Path, r.Slots())
+	if reservation == nil {
+		return nil, &job.RateLimitError{Quotas: exhausted}
+	}
+
+	b := &Booking{
+		at:          t,
+		key:         r.Key,
+		path:        r.Path,
+		weight:      r.Weight,
+		reservation: reservation,
+	}
+
+	return b, nil
+}
+
+// ExecuteBooked executes the job on the booked slots at the time of the booking.
+// The job is put ahead of all queued jobs at the time. If it's started later,
+// the slots are moved to the start of the job, or the job waits for free slots
+// if they don't fit there. The key, the path and the weight of the booking override options.
+// Cache and deduplication options are not applied.
+func (l *RateLimiter) ExecuteBooked(b *Booking, j job.Job, opts ...Option) <-chan job.Response {
+	l.wg.Add(1)
+
+	ch := make(chan job.Response)
+	r := job.Request{Job: j, Ch: ch}
+
+	for _, opt := range opts {
+		opt(&r)
+	}
+
+	l.intercept(&r)
+
+	r.Key = b.key
+	r.Path = b.path
+	r.Weight = b.weight
+
+	b.stateLock.Lock()
+	defer b.stateLock.Unlock()
+
+	switch b.state {
+	case bookingCanceled:
+		l.reject(r, job.ErrBookingCanceled)
+
+		return ch
+	case bookingScheduled, bookingUsed:
+		l.reject(r, job.ErrBookingUsed)
+
+		return ch
+	}
+
+	r.Reservation = b.reservation
+	b.state = bookingScheduled
+
+	timer := time.AfterFunc(time.Until(b.at), func() {
+		b.stateLock.Lock()
+		if b.state != bookingScheduled {
+			b.stateLock.Unlock()
+			return
+		}
+		b.state = bookingUsed
+		b.stateLock.Unlock()
+
+		// the job is ahead of others to start at the booked time
+		l.pushFront(r)
+	})
+
+	b.cancel = func() {
+		timer.Stop()
+
+		l.respond(r, job.Response{
+			Result: nil,
+			Error:  job.ErrBookingCanceled,
+		})
+	}
+
+	return ch
+}
+
+// ExecuteAt books slots at the time and executes the job on them.
+// The job can be canceled with the returned booking before it's started.
+func (l *RateLimiter) ExecuteAt(t time.Time, j job.Job, opts ...Option) (<-chan job.Response, *Booking, error) {
+	b, err := l.ReserveAt(t, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return l.ExecuteBooked(b, j, opts...), b, nil
+}
@@ -0,0 +1,165 @@
+package limiter
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/chatex-com/rate-limiter/pkg/config"
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+func TestExecuteAt(t *testing.T) {
+	Convey("Job is executed on slots booked in advance", t, func() {
+		cfg := config.NewConfigWithQuotas([]*config.Quota{
+			config.NewQuota(1, time.Second),
+		})
+		l, _ := NewRateLimiter(cfg)
+		l.Start()
+
+		at := time.Now().Add(50 * time.Millisecond)
+		ch, b, err := l.ExecuteAt(at, func() (interface{}, error) {
+			return time.Now(), nil
+		})
+		So(err, ShouldBeNil)
+		So(b.At(), ShouldEqual, at)
+
+		// ad-hoc jobs can't take the booked slot
+		_, err = l.TryExecute(func() (interface{}, error) {
+			return nil, nil
+		})
+		So(errors.Is(err, job.ErrRateLimited), ShouldBeTrue)
+
+		_, err = l.ReserveAt(at.Add(500 * time.Millisecond))
+		So(errors.Is(err, job.ErrRateLimited), ShouldBeTrue)
+
+		resp := <-ch
+		So(resp.Error, ShouldBeNil)
+		So(resp.Result.(time.Time), ShouldHappenOnOrAfter, at)
+
+		// the job was already started
+		So(b.Cancel(), ShouldBeFalse)
+		So(errors.Is((<-l.ExecuteBooked(b, func() (interface{}, error) {
+			return nil, nil
+		})).Error, job.ErrBookingUsed), ShouldBeTrue)
+	})
+
+	Convey("Canceled booking returns slots", t, func() {
+		cfg := config.NewConfigWithQuotas([]*config.Quota{
+			config.NewQuota(1, time.Hour),
+		})
+		l, _ := NewRateLimiter(cfg)
+		l.Start()
+
+		ch, b, err := l.ExecuteAt(time.Now().Add(time.Hour), func() (interface{}, error) {
+			return "foo", nil
+		})
+		So(err, ShouldBeNil)
+
+		So(b.Cancel(), ShouldBeTrue)
+		So(b.Cancel(), ShouldBeFalse)
+		So((<-ch).Error, ShouldEqual, job.ErrBookingCanceled)
+
+		resp := <-l.ExecuteWithOptions(func() (interface{}, error) {
+			return "bar", nil
+		}, WithTimeout(time.Second))
+		So(resp.Error, ShouldBeNil)
+		So(resp.Result, ShouldEqual, "bar")
+
+		So(errors.Is((<-l.ExecuteBooked(b, func() (interface{}, error) {
+			return nil, nil
+		})).Error, job.ErrBookingCanceled), ShouldBeTrue)
+
+		l.AwaitAll()
+	})
+
+	Convey("Booking of the key with weight", t, func() {
+		cfg := config.NewConfig()
+		cfg.Concurrency = 1
+		cfg.AddKeyQuota(config.NewQuota(2, time.Hour))
+		l, _ := NewRateLimiter(cfg)
+
+		_, err := l.ReserveAt(time.Now(), WithKey("foo"), WithWeight(3))
+		So(err, ShouldEqual, job.ErrWeightExceedsCapacity)
+
+		b, err := l.ReserveAt(time.Now().Add(time.Minute), WithKey("foo"), WithWeight(2))
+		So(err, ShouldBeNil)
+
+		_, err = l.TryExecute(func() (interface{}, error) {
+			return nil, nil
+		}, WithKey("foo"))
+		So(errors.Is(err, job.ErrRateLimited), ShouldBeTrue)
+
+		So(b.Cancel(), ShouldBeTrue)
+		_, err = l.ReserveAt(time.Now().Add(time.Minute), WithKey("foo"), WithWeight(2))
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Booked job started late takes slots at the start", t, func() {
+		cfg := config.NewConfig()
+		cfg.Concurrency = 1
+		cfg.AddKeyQuota(config.NewQuota(1, 200*time.Millisecond))
+		l, _ := NewRateLimiter(cfg)
+		l.Start()
+
+		now := func() (interface{}, error) {
+			return time.Now(), nil
+		}
+
+		// the only worker is busy at the booked time
+		slow := l.ExecuteWithOptions(func() (interface{}, error) {
+			time.Sleep(150 * time.Millisecond)
+			return nil, nil
+		}, WithKey("A"))
+
+		ch, _, err := l.ExecuteAt(time.Now().Add(50*time.Millisecond), now, WithKey("B"))
+		So(err, ShouldBeNil)
+		<-slow
+
+		started := (<-ch).Result.(time.Time)
+		next := (<-l.ExecuteWithOptions(now, WithKey("B"))).Result.(time.Time)
+		So(next.Sub(started), ShouldBeGreaterThanOrEqualTo, 200*time.Millisecond)
+	})
+
+	Convey("Booked jobs take slots of concurrency quotas", t, func() {
+		cfg := config.NewConfigWithQuotas([]*config.Quota{
+			config.NewConcurrencyQuota(1),
+		})
+		cfg.Concurrency = 3
+		l, _ := NewRateLimiter(cfg)
+		l.Start()
+
+		var running, maxRunning int32
+		j := func() (interface{}, error) {
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+
+			for {
+				m := atomic.LoadInt32(&maxRunning)
+				if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+					break
+				}
+			}
+
+			time.Sleep(30 * time.Millisecond)
+
+			return nil, nil
+		}
+
+		at := time.Now().Add(20 * time.Millisecond)
+		ch1 := l.Execute(j)
+		ch2, _, err := l.ExecuteAt(at, j)
+		So(err, ShouldBeNil)
+		ch3, _, err := l.ExecuteAt(at, j)
+		So(err, ShouldBeNil)
+
+		for _, ch := range []<-chan job.Response{ch1, ch2, ch3} {
+			So((<-ch).Error, ShouldBeNil)
+		}
+
+		So(atomic.LoadInt32(&maxRunning), ShouldEqual, 1)
+	})
+}
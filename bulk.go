@@ -0,0 +1,119 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+var ErrNoBulkResult = errors.New("bulk job returned no result for the id")
+
+// BulkJob executes a single upstream request for all ids and returns results by id
+type BulkJob func(ctx context.Context, ids []string) (map[string]interface{}, error)
+
+// BulkExecutor collects individual requests for up to maxDelay or maxSize
+// and executes them with one bulk job consuming one quota slot
+type BulkExecutor struct {
+	limiter  *RateLimiter
+	job      BulkJob
+	maxSize  int
+	maxDelay time.Duration
+	opts     []Option
+
+	ids         []string
+	subscribers map[string][]chan job.Response
+	timer       *time.Timer
+	mu          sync.Mutex
+}
+
+// NewBulkExecutor creates the executor. Options are applied to every bulk job.
+func NewBulkExecutor(l *RateLimiter, j BulkJob, maxSize int, maxDelay time.Duration, opts ...Option) *BulkExecutor {
+	return &BulkExecutor{
+		limiter:     l,
+		job:         j,
+		maxSize:     maxSize,
+		maxDelay:    maxDelay,
+		opts:        opts,
+		subscribers: make(map[string][]chan job.Response),
+	}
+}
+
+// Execute adds the id to the current batch. Requests with the same id
+// within the batch receive the same response.
+func (b *BulkExecutor) Execute(id string) <-chan job.Response {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan job.Response)
+
+	if _, ok := b.subscribers[id]; !ok {
+		b.ids = append(b.ids, id)
+	}
+	b.subscribers[id] = append(b.subscribers[id], ch)
+
+	if len(b.ids) >= b.maxSize {
+		b.flush()
+	} else if b.timer == nil {
+		b.timer = time.AfterFunc(b.maxDelay, b.Flush)
+	}
+
+	return ch
+}
+
+// Flush executes the current batch immediately
+func (b *BulkExecutor) Flush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.flush()
+}
+
+func (b *BulkExecutor) flush() {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+
+	if len(b.ids) == 0 {
+		return
+	}
+
+	ids := b.ids
+	subscribers := b.subscribers
+	b.ids = nil
+	b.subscribers = make(map[string][]chan job.Response)
+
+	ch := b.limiter.execute(job.Request{
+		ContextJob: func(ctx context.Context) (interface{}, error) {
+			return b.job(ctx, ids)
+		},
+	}, b.opts)
+
+	go func() {
+		resp := <-ch
+		results, _ := resp.Result.(map[string]interface{})
+
+		for id, chs := range subscribers {
+			r := job.Response{Error: resp.Error}
+
+			if resp.Error == nil {
+				result, ok := results[id]
+				if ok {
+					r.Result = result
+				} else {
+					r.Error = ErrNoBulkResult
+				}
+			}
+
+			for _, ch := range chs {
+				go func(ch chan job.Response) {
+					ch <- r
+					close(ch)
+				}(ch)
+			}
+		}
+	}()
+}
@@ -0,0 +1,60 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBulkExecutor(t *testing.T) {
+	Convey("Flush by max size", t, func() {
+		l := newTestRateLimiter()
+
+		var calls int32
+		b := NewBulkExecutor(l, func(ctx context.Context, ids []string) (map[string]interface{}, error) {
+			atomic.AddInt32(&calls, 1)
+
+			results := make(map[string]interface{})
+			for _, id := range ids {
+				if id != "missing" {
+					results[id] = "price:" + id
+				}
+			}
+
+			return results, nil
+		}, 3, time.Hour)
+
+		ch1 := b.Execute("BTC")
+		ch2 := b.Execute("BTC")
+		ch3 := b.Execute("ETH")
+		ch4 := b.Execute("missing")
+
+		So((<-ch1).Result, ShouldEqual, "price:BTC")
+		So((<-ch2).Result, ShouldEqual, "price:BTC")
+		So((<-ch3).Result, ShouldEqual, "price:ETH")
+		So((<-ch4).Error, ShouldEqual, ErrNoBulkResult)
+		So(atomic.LoadInt32(&calls), ShouldEqual, 1)
+	})
+
+	Convey("Flush by max delay", t, func() {
+		l := newTestRateLimiter()
+
+		var size int32
+		b := NewBulkExecutor(l, func(ctx context.Context, ids []string) (map[string]interface{}, error) {
+			atomic.StoreInt32(&size, int32(len(ids)))
+
+			return nil, errors.New("upstream error")
+		}, 100, 10*time.Millisecond)
+
+		ch1 := b.Execute("BTC")
+		ch2 := b.Execute("ETH")
+
+		So((<-ch1).Error, ShouldBeError)
+		So((<-ch2).Error, ShouldBeError)
+		So(atomic.LoadInt32(&size), ShouldEqual, 2)
+	})
+}
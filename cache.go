@@ -0,0 +1,68 @@
+package limiter
+
+import (
+	"context"
+
+	"github.com/chatex-com/rate-limiter/internal/cache"
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+// fromCache responds with the cached response. The stale response is served
+// only if quota is exhausted; in this case the response is refreshed in background.
+func (l *RateLimiter) fromCache(r job.Request) bool {
+	_, free := l.quotas.GetFreeSlotPath(r.Key, r.Path)
+	resp, state := l.cache.Get(r.CacheKey, !free)
+
+	switch state {
+	case cache.StateFresh:
+		l.respond(r, resp)
+	case cache.StateStale:
+		l.respond(r, resp)
+		l.refresh(r)
+	default:
+		return false
+	}
+
+	return true
+}
+
+// cacheResult wraps the job of the request to store its successful response.
+// Interceptors are run once around the original job, so their result is cached.
+func (l *RateLimiter) cacheResult(r job.Request) job.Request {
+	orig := r
+
+	r.Interceptors = nil
+	r.Job = nil
+	r.ContextJob = func(ctx context.Context) (interface{}, error) {
+		orig.Ctx = ctx
+		result, err := orig.Run()
+
+		if err == nil {
+			l.cache.Set(r.CacheKey, job.Response{Result: result}, r.CacheTTL, r.CacheStaleTTL)
+		}
+
+		return result, err
+	}
+
+	return r
+}
+
+func (l *RateLimiter) refresh(r job.Request) {
+	if !l.cache.StartRefresh(r.CacheKey) {
+		return
+	}
+
+	l.wg.Add(1)
+
+	ch := make(chan job.Response)
+	r.Ch = ch
+
+	l.push(l.cacheResult(r))
+
+	go func() {
+		resp := <-ch
+		if resp.Error != nil {
+			l.cache.FinishRefresh(r.CacheKey)
+		}
+	}()
+}
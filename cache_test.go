@@ -0,0 +1,83 @@
+package limiter
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/chatex-com/rate-limiter/pkg/config"
+)
+
+func TestCache(t *testing.T) {
+	Convey("Cached response doesn't touch quotas", t, func() {
+		cfg := config.NewConfigWithQuotas([]*config.Quota{
+			config.NewQuota(1, time.Hour),
+		})
+		l, _ := NewRateLimiter(cfg)
+		l.Start()
+
+		var executed int32
+		j := func() (interface{}, error) {
+			return atomic.AddInt32(&executed, 1), nil
+		}
+
+		resp := <-l.ExecuteWithOptions(j, WithCache("foo", time.Hour, 0))
+		So(resp.Result, ShouldEqual, 1)
+
+		resp = <-l.ExecuteWithOptions(j, WithCache("foo", time.Hour, 0))
+		So(resp.Error, ShouldBeNil)
+		So(resp.Result, ShouldEqual, 1)
+
+		l.AwaitAll()
+		stat := l.Stat()
+		So(stat.CacheHits, ShouldEqual, 1)
+		So(stat.CacheMisses, ShouldEqual, 1)
+		So(stat.Done, ShouldEqual, 1)
+	})
+
+	Convey("Errors are not cached", t, func() {
+		l := newTestRateLimiter()
+
+		var executed int32
+		j := func() (interface{}, error) {
+			atomic.AddInt32(&executed, 1)
+			return nil, ErrNoFutures
+		}
+
+		<-l.ExecuteWithOptions(j, WithCache("foo", time.Hour, 0))
+		<-l.ExecuteWithOptions(j, WithCache("foo", time.Hour, 0))
+
+		So(atomic.LoadInt32(&executed), ShouldEqual, 2)
+	})
+
+	Convey("Stale response is served when quota is exhausted", t, func() {
+		cfg := config.NewConfigWithQuotas([]*config.Quota{
+			config.NewQuota(1, 50*time.Millisecond),
+		})
+		l, _ := NewRateLimiter(cfg)
+		l.Start()
+
+		var executed int32
+		j := func() (interface{}, error) {
+			return atomic.AddInt32(&executed, 1), nil
+		}
+
+		resp := <-l.ExecuteWithOptions(j, WithCache("foo", 10*time.Millisecond, time.Hour))
+		So(resp.Result, ShouldEqual, 1)
+
+		time.Sleep(20 * time.Millisecond)
+
+		// quota is exhausted, stale response is served and refreshed in background
+		resp = <-l.ExecuteWithOptions(j, WithCache("foo", time.Hour, time.Hour))
+		So(resp.Result, ShouldEqual, 1)
+		So(l.Stat().CacheStale, ShouldEqual, 1)
+
+		l.AwaitAll()
+		So(atomic.LoadInt32(&executed), ShouldEqual, 2)
+
+		resp = <-l.ExecuteWithOptions(j, WithCache("foo", time.Hour, time.Hour))
+		So(resp.Result, ShouldEqual, 2)
+	})
+}
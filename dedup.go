@@ -0,0 +1,227 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+// flights holds requests in progress by dedup key. Concurrent requests
+// with the same key share the first request and its quota reservation.
+type flights struct {
+	m  map[string]*flight
+	mu sync.Mutex
+}
+
+// flight is the request in progress and its followers
+type flight struct {
+	followers []*follower
+	started   int32
+}
+
+// follower is the request waiting for the response of the flight
+type follower struct {
+	r        job.Request
+	in       chan job.Response
+	promoted chan struct{}
+}
+
+func newFlights() *flights {
+	return &flights{
+		m: make(map[string]*flight),
+	}
+}
+
+// share subscribes the request to the request in progress with the same dedup key.
+// It returns false if there is no such request; in this case the request becomes
+// the leader and its response channel is replaced to fan out the response.
+func (l *RateLimiter) share(r *job.Request) bool {
+	l.flights.mu.Lock()
+	defer l.flights.mu.Unlock()
+
+	if f, ok := l.flights.m[r.DedupKey]; ok {
+		fl := &follower{
+			r:        *r,
+			in:       make(chan job.Response, 1),
+			promoted: make(chan struct{}),
+		}
+		f.followers = append(f.followers, fl)
+		atomic.AddInt64(&l.deduplicated, 1)
+
+		go l.follow(f, fl)
+
+		return true
+	}
+
+	f := &flight{}
+	l.flights.m[r.DedupKey] = f
+
+	ch := make(chan job.Response)
+	leader := f.lead(r, ch)
+
+	go l.fanOut(r.DedupKey, ch, leader)
+
+	return false
+}
+
+// lead makes the request the leader of the flight. It returns the response
+// channel of the caller which is replaced by the channel of the flight.
+func (f *flight) lead(r *job.Request, ch chan job.Response) chan job.Response {
+	// followers wait for the response regardless of their deadline once the job is started
+	r.Interceptors = append([]job.Interceptor{f.start}, r.Interceptors...)
+
+	leader := r.Ch
+	r.Ch = ch
+
+	return leader
+}
+
+func (l *RateLimiter) fanOut(key string, ch chan job.Response, leader chan job.Response) {
+	var (
+		resp job.Response
+		f    *flight
+	)
+
+	for {
+		resp = <-ch
+
+		l.flights.mu.Lock()
+		f = l.flights.m[key]
+
+		next := f.promote(resp)
+		if next == nil {
+			delete(l.flights.m, key)
+			l.flights.mu.Unlock()
+
+			break
+		}
+
+		// the leader gave up before the job was started, the job is handed over to the follower
+		r := next.r
+		ch = make(chan job.Response)
+		caller := f.lead(&r, ch)
+		l.flights.mu.Unlock()
+
+		l.deliver(leader, resp)
+		leader = caller
+
+		// the follower is counted by the worker from now on
+		l.pushFront(r)
+	}
+
+	// the leader request is marked as done by the worker
+	l.deliver(leader, resp)
+
+	for _, fl := range f.followers {
+		fl.in <- resp
+	}
+}
+
+// deliver passes the response to the caller of the leader request
+func (l *RateLimiter) deliver(ch chan job.Response, resp job.Response) {
+	go func() {
+		ch <- resp
+		close(ch)
+	}()
+}
+
+// promote takes the first follower if the leader gave up before the job was started.
+// The lock of flights must be held.
+func (f *flight) promote(resp job.Response) *follower {
+	if f.isStarted() || len(f.followers) == 0 || !gaveUp(resp.Error) {
+		return nil
+	}
+
+	next := f.followers[0]
+	f.followers = f.followers[1:]
+	close(next.promoted)
+
+	return next
+}
+
+// gaveUp checks if the job wasn't started because of the deadline or the context of the request
+func gaveUp(err error) bool {
+	return errors.Is(err, job.ErrJobExpired) ||
+		errors.Is(err, job.ErrWouldExpire) ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+// follow passes the response of the flight to the follower. The follower is failed
+// if its deadline passes or its context is done before the shared job is started.
+// The promoted follower is handled by the queue and workers as any other request.
+func (l *RateLimiter) follow(f *flight, fl *follower) {
+	var expiry <-chan time.Time
+	if !fl.r.ExpiredAt.IsZero() {
+		timer := time.NewTimer(time.Until(fl.r.ExpiredAt))
+		defer timer.Stop()
+		expiry = timer.C
+	}
+
+	done := fl.r.Context().Done()
+
+	var resp job.Response
+	for received := false; !received; {
+		select {
+		case resp = <-fl.in:
+			received = true
+		case <-fl.promoted:
+			return
+		case <-expiry:
+			expiry = nil
+			received = l.leave(f, fl)
+			resp = job.Response{Error: &job.ExpiredError{}}
+		case <-done:
+			done = nil
+			received = l.leave(f, fl)
+			resp = job.Response{Error: fl.r.Context().Err()}
+		}
+	}
+
+	fl.r.Ch <- resp
+	close(fl.r.Ch)
+
+	l.wg.Done()
+}
+
+// leave unsubscribes the follower from the flight if the shared job isn't started yet
+func (l *RateLimiter) leave(f *flight, fl *follower) bool {
+	l.flights.mu.Lock()
+	defer l.flights.mu.Unlock()
+
+	if f.isStarted() {
+		return false
+	}
+
+	select {
+	case <-fl.promoted:
+		return false
+	default:
+	}
+
+	for i, other := range f.followers {
+		if other == fl {
+			f.followers = append(f.followers[:i:i], f.followers[i+1:]...)
+			break
+		}
+	}
+
+	return true
+}
+
+// start is the interceptor of the leader job which marks the flight started
+func (f *flight) start(next job.ContextJob) job.ContextJob {
+	return func(ctx context.Context) (interface{}, error) {
+		atomic.StoreInt32(&f.started, 1)
+
+		return next(ctx)
+	}
+}
+
+func (f *flight) isStarted() bool {
+	return atomic.LoadInt32(&f.started) == 1
+}
@@ -0,0 +1,140 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/chatex-com/rate-limiter/pkg/config"
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+func TestDedup(t *testing.T) {
+	Convey("Concurrent requests share one job", t, func() {
+		l := newTestRateLimiter()
+
+		var executed int32
+		j := func() (interface{}, error) {
+			atomic.AddInt32(&executed, 1)
+			time.Sleep(20 * time.Millisecond)
+
+			return "ticker", nil
+		}
+
+		chs := []<-chan job.Response{
+			l.ExecuteWithOptions(j, WithDedupKey("BTC")),
+			l.ExecuteWithOptions(j, WithDedupKey("BTC")),
+			l.ExecuteWithOptions(j, WithDedupKey("BTC")),
+		}
+
+		for _, ch := range chs {
+			resp := <-ch
+			So(resp.Error, ShouldBeNil)
+			So(resp.Result, ShouldEqual, "ticker")
+		}
+
+		l.AwaitAll()
+		So(atomic.LoadInt32(&executed), ShouldEqual, 1)
+		So(l.Stat().Deduplicated, ShouldEqual, 2)
+		So(l.flights.m, ShouldBeEmpty)
+	})
+
+	Convey("Deadline and context of the follower are respected till the job is started", t, func() {
+		l, _ := NewRateLimiter(config.NewConfig())
+
+		j := func() (interface{}, error) {
+			return "ticker", nil
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		leader := l.ExecuteWithOptions(j, WithDedupKey("BTC"))
+		expired := l.ExecuteWithOptions(j, WithDedupKey("BTC"), WithTimeout(10*time.Millisecond))
+		canceled := l.ExecuteWithOptions(j, WithDedupKey("BTC"), WithContext(ctx))
+		follower := l.ExecuteWithOptions(j, WithDedupKey("BTC"), WithTimeout(time.Hour))
+
+		So(errors.Is((<-expired).Error, job.ErrJobExpired), ShouldBeTrue)
+
+		cancel()
+		So((<-canceled).Error, ShouldEqual, context.Canceled)
+
+		l.Start()
+		So((<-leader).Result, ShouldEqual, "ticker")
+		So((<-follower).Result, ShouldEqual, "ticker")
+
+		l.AwaitAll()
+		So(l.Stat().Deduplicated, ShouldEqual, 3)
+	})
+
+	Convey("Follower takes over the job if the leader gives up before the start", t, func() {
+		l, _ := NewRateLimiter(config.NewConfig())
+
+		var executed int32
+		j := func() (interface{}, error) {
+			atomic.AddInt32(&executed, 1)
+
+			return "ticker", nil
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		canceled := l.ExecuteWithOptions(j, WithDedupKey("BTC"), WithContext(ctx))
+		expired := l.ExecuteWithOptions(j, WithDedupKey("ETH"), WithTimeout(10*time.Millisecond))
+		follower1 := l.ExecuteWithOptions(j, WithDedupKey("BTC"))
+		follower2 := l.ExecuteWithOptions(j, WithDedupKey("BTC"))
+		follower3 := l.ExecuteWithOptions(j, WithDedupKey("ETH"))
+
+		cancel()
+		So(errors.Is((<-expired).Error, job.ErrJobExpired), ShouldBeTrue)
+
+		l.Start()
+		So((<-canceled).Error, ShouldEqual, context.Canceled)
+		So((<-follower1).Result, ShouldEqual, "ticker")
+		So((<-follower2).Result, ShouldEqual, "ticker")
+		So((<-follower3).Result, ShouldEqual, "ticker")
+
+		l.AwaitAll()
+		So(atomic.LoadInt32(&executed), ShouldEqual, 2)
+		So(l.flights.m, ShouldBeEmpty)
+	})
+
+	Convey("Follower gets the response if its deadline passes after the start", t, func() {
+		l := newTestRateLimiter()
+
+		j := func() (interface{}, error) {
+			time.Sleep(30 * time.Millisecond)
+
+			return "ticker", nil
+		}
+
+		leader := l.ExecuteWithOptions(j, WithDedupKey("BTC"))
+		time.Sleep(5 * time.Millisecond)
+		follower := l.ExecuteWithOptions(j, WithDedupKey("BTC"), WithTimeout(10*time.Millisecond))
+
+		So((<-follower).Result, ShouldEqual, "ticker")
+		So((<-leader).Result, ShouldEqual, "ticker")
+	})
+
+	Convey("Different keys and sequential requests are not shared", t, func() {
+		l := newTestRateLimiter()
+
+		var executed int32
+		j := func() (interface{}, error) {
+			atomic.AddInt32(&executed, 1)
+
+			return nil, nil
+		}
+
+		ch1 := l.ExecuteWithOptions(j, WithDedupKey("BTC"))
+		ch2 := l.ExecuteWithOptions(j, WithDedupKey("ETH"))
+		<-ch1
+		<-ch2
+		<-l.ExecuteWithOptions(j, WithDedupKey("BTC"))
+
+		l.AwaitAll()
+		So(atomic.LoadInt32(&executed), ShouldEqual, 3)
+		So(l.Stat().Deduplicated, ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,393 @@
+package limiter
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+var (
+	ErrUnknownHandler = errors.New("job handler is not registered")
+	ErrQueueClosed    = errors.New("durable queue is closed")
+	ErrReplayed       = errors.New("pending jobs are already replayed")
+)
+
+const (
+	walOpAdd = "add"
+	walOpAck = "ack"
+)
+
+// Handler executes the job described by the payload
+type Handler func(ctx context.Context, payload []byte) (interface{}, error)
+
+// DurableQueue keeps submitted jobs in an append-only log on the local disk till
+// they are completed, so pending jobs can be replayed after restart. Jobs are
+// described by the name of a registered handler and a serialized payload.
+// Jobs are executed at least once: a completed job can be replayed if
+// the process is stopped before the acknowledgement is written.
+// A job is acknowledged when its response is received, including responses
+// of WithCache and WithDedupKey which don't run the handler. Only jobs rejected
+// by the limiter with a retryable error (see retryable) stay pending till
+// the next replay, unless their deadline has passed.
+type DurableQueue struct {
+	limiter  *RateLimiter
+	path     string
+	file     *os.File
+	handlers map[string]Handler
+	pending  map[uint64]walRecord
+	// loaded are IDs of pending jobs left after restart till they are replayed
+	loaded   []uint64
+	replayed bool
+	nextID   uint64
+	closed   bool
+	mu       sync.Mutex
+}
+
+type walRecord struct {
+	Op      string `json:"op"`
+	ID      uint64 `json:"id"`
+	Handler string `json:"handler,omitempty"`
+	Payload []byte `json:"payload,omitempty"`
+	// options of the job which are applied on replay
+	Key      string     `json:"key,omitempty"`
+	Path     []string   `json:"path,omitempty"`
+	Tenant   string     `json:"tenant,omitempty"`
+	Weight   uint       `json:"weight,omitempty"`
+	Deadline *time.Time `json:"deadline,omitempty"`
+}
+
+// NewDurableQueue opens the log at the path or creates it. Jobs which weren't
+// completed before are kept pending till Replay is called.
+func NewDurableQueue(l *RateLimiter, path string) (*DurableQueue, error) {
+	q := &DurableQueue{
+		limiter:  l,
+		path:     path,
+		handlers: make(map[string]Handler),
+		pending:  make(map[uint64]walRecord),
+		nextID:   1,
+	}
+
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+
+	if err := q.compact(); err != nil {
+		return nil, err
+	}
+
+	q.loaded = q.pendingIDs()
+
+	return q, nil
+}
+
+// Register sets the handler of jobs with the name.
+// Handlers of pending jobs must be registered before Replay.
+func (q *DurableQueue) Register(name string, h Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.handlers[name] = h
+}
+
+// Submit writes the job to the log and executes it with the handler.
+// The job is acknowledged in the log once it's completed. The key, the path,
+// the tenant, the weight and the deadline of the job are written to the log too.
+func (q *DurableQueue) Submit(name string, payload []byte, opts ...Option) (<-chan job.Response, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return nil, ErrQueueClosed
+	}
+
+	h, ok := q.handlers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownHandler, name)
+	}
+
+	r := job.Request{}
+	for _, opt := range opts {
+		opt(&r)
+	}
+
+	rec := walRecord{
+		Op:      walOpAdd,
+		ID:      q.nextID,
+		Handler: name,
+		Payload: payload,
+		Key:     r.Key,
+		Path:    r.Path,
+		Tenant:  r.Tenant,
+		Weight:  r.Weight,
+	}
+	if !r.ExpiredAt.IsZero() {
+		rec.Deadline = &r.ExpiredAt
+	}
+
+	if err := q.write(rec, true); err != nil {
+		return nil, err
+	}
+
+	q.nextID++
+	q.pending[rec.ID] = rec
+
+	return q.run(rec, h, opts), nil
+}
+
+// Replay executes pending jobs left after restart with their options written
+// to the log and returns their number. The options override the written ones.
+// Nothing is executed if a handler of any pending job is not registered.
+// Jobs are replayed only once, subsequent calls fail with ErrReplayed.
+func (q *DurableQueue) Replay(opts ...Option) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return 0, ErrQueueClosed
+	}
+
+	if q.replayed {
+		return 0, ErrReplayed
+	}
+
+	var records []walRecord
+	for _, id := range q.loaded {
+		rec, ok := q.pending[id]
+		if !ok {
+			continue
+		}
+
+		if _, ok := q.handlers[rec.Handler]; !ok {
+			return 0, fmt.Errorf("%w: %s", ErrUnknownHandler, rec.Handler)
+		}
+
+		records = append(records, rec)
+	}
+
+	for _, rec := range records {
+		q.run(rec, q.handlers[rec.Handler], append(rec.options(), opts...))
+	}
+
+	q.replayed = true
+	q.loaded = nil
+
+	return len(records), nil
+}
+
+// Pending returns the number of jobs which are not completed yet
+func (q *DurableQueue) Pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.pending)
+}
+
+// Close closes the log. Jobs completed after closing stay pending in the log.
+func (q *DurableQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return nil
+	}
+
+	q.closed = true
+
+	return q.file.Close()
+}
+
+func (q *DurableQueue) run(rec walRecord, h Handler, opts []Option) <-chan job.Response {
+	out := make(chan job.Response, 1)
+
+	var started int32
+	ch := q.limiter.ExecuteContext(context.Background(), func(ctx context.Context) (interface{}, error) {
+		atomic.StoreInt32(&started, 1)
+
+		return h(ctx, rec.Payload)
+	}, opts...)
+
+	go func() {
+		resp := <-ch
+
+		// a job rejected by the limiter is replayed after restart unless it can't be started anymore
+		if atomic.LoadInt32(&started) == 1 || !retryable(resp.Error) || rec.isExpired() {
+			q.ack(rec.ID)
+		}
+
+		out <- resp
+		close(out)
+	}()
+
+	return out
+}
+
+// retryable checks if the job was rejected by the limiter and can be executed later:
+// the circuit breaker was open, the weight exceeded the capacity or the job was
+// expected to expire before its start.
+func retryable(err error) bool {
+	return errors.Is(err, job.ErrCircuitOpen) ||
+		errors.Is(err, job.ErrWeightExceedsCapacity) ||
+		errors.Is(err, job.ErrWouldExpire) ||
+		errors.Is(err, job.ErrJobExpired)
+}
+
+// options returns options of the job written to the log
+func (rec walRecord) options() []Option {
+	opts := []Option{WithKey(rec.Key), WithPath(rec.Path...), WithTenant(rec.Tenant), WithWeight(rec.Weight)}
+
+	if rec.Deadline != nil {
+		deadline := *rec.Deadline
+		opts = append(opts, func(r *job.Request) {
+			r.ExpiredAt = deadline
+		})
+	}
+
+	return opts
+}
+
+// isExpired checks if the deadline of the job has passed
+func (rec walRecord) isExpired() bool {
+	return rec.Deadline != nil && time.Now().After(*rec.Deadline)
+}
+
+func (q *DurableQueue) ack(id uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return
+	}
+
+	// the job is replayed again if the acknowledgement is lost
+	if err := q.write(walRecord{Op: walOpAck, ID: id}, false); err != nil {
+		return
+	}
+
+	delete(q.pending, id)
+}
+
+func (q *DurableQueue) write(rec walRecord, flush bool) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	info, err := q.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if _, err = q.file.Write(append(data, '\n')); err != nil {
+		// a partially written record would be glued to the next one
+		_ = q.file.Truncate(info.Size())
+
+		return err
+	}
+
+	if flush {
+		return q.file.Sync()
+	}
+
+	return nil
+}
+
+// load reads pending jobs from the log. Unparsable records (e.g. the process
+// was killed on writing) are skipped.
+func (q *DurableQueue) load() error {
+	f, err := os.Open(q.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// the last record is torn
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var rec walRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			continue
+		}
+
+		switch rec.Op {
+		case walOpAdd:
+			q.pending[rec.ID] = rec
+		case walOpAck:
+			delete(q.pending, rec.ID)
+		}
+
+		if rec.ID >= q.nextID {
+			q.nextID = rec.ID + 1
+		}
+	}
+}
+
+// compact rewrites the log with pending jobs only and opens it for appending
+func (q *DurableQueue) compact() error {
+	tmp := q.path + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	q.file = f
+
+	for _, id := range q.pendingIDs() {
+		if err := q.write(q.pending[id], false); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, q.path); err != nil {
+		return err
+	}
+
+	q.file, err = os.OpenFile(q.path, os.O_APPEND|os.O_WRONLY, 0o600)
+
+	return err
+}
+
+// pendingIDs returns IDs of pending jobs in the submission order
+func (q *DurableQueue) pendingIDs() []uint64 {
+	ids := make([]uint64, 0, len(q.pending))
+	for id := range q.pending {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	return ids
+}
@@ -0,0 +1,218 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/chatex-com/rate-limiter/pkg/config"
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+func TestDurableQueue(t *testing.T) {
+	echo := func(ctx context.Context, payload []byte) (interface{}, error) {
+		return string(payload), nil
+	}
+
+	Convey("Completed jobs are acknowledged", t, func() {
+		path := filepath.Join(t.TempDir(), "jobs.wal")
+		l := newTestRateLimiter()
+		q, err := NewDurableQueue(l, path)
+		So(err, ShouldBeNil)
+		q.Register("echo", echo)
+
+		ch, err := q.Submit("echo", []byte("foo"))
+		So(err, ShouldBeNil)
+		So((<-ch).Result, ShouldEqual, "foo")
+		So(q.Pending(), ShouldEqual, 0)
+		So(q.Close(), ShouldBeNil)
+
+		q, err = NewDurableQueue(l, path)
+		So(err, ShouldBeNil)
+		So(q.Pending(), ShouldEqual, 0)
+	})
+
+	Convey("Pending jobs are replayed after restart", t, func() {
+		path := filepath.Join(t.TempDir(), "jobs.wal")
+
+		// the limiter is not started, so jobs are never completed
+		l, _ := NewRateLimiter(config.NewConfig())
+		q, _ := NewDurableQueue(l, path)
+		q.Register("echo", echo)
+		_, _ = q.Submit("echo", []byte("foo"))
+		_, _ = q.Submit("echo", []byte("bar"))
+		So(q.Pending(), ShouldEqual, 2)
+		So(q.Close(), ShouldBeNil)
+
+		_, err := q.Submit("echo", []byte("baz"))
+		So(err, ShouldEqual, ErrQueueClosed)
+
+		// the process was killed on writing the next record
+		f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+		_, _ = f.WriteString(`{"op":"add","id":3,"hand`)
+		_ = f.Close()
+
+		q, err = NewDurableQueue(newTestRateLimiter(), path)
+		So(err, ShouldBeNil)
+		So(q.Pending(), ShouldEqual, 2)
+
+		_, err = q.Replay()
+		So(errors.Is(err, ErrUnknownHandler), ShouldBeTrue)
+
+		replayed := make(chan string, 2)
+		q.Register("echo", func(ctx context.Context, payload []byte) (interface{}, error) {
+			replayed <- string(payload)
+
+			return nil, nil
+		})
+
+		n, err := q.Replay()
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 2)
+		payloads := []string{<-replayed, <-replayed}
+		So(payloads, ShouldContain, "foo")
+		So(payloads, ShouldContain, "bar")
+
+		_, err = q.Replay()
+		So(err, ShouldEqual, ErrReplayed)
+
+		for q.Pending() > 0 {
+			time.Sleep(time.Millisecond)
+		}
+		So(q.Close(), ShouldBeNil)
+
+		// IDs of new jobs don't collide with the replayed ones
+		q, _ = NewDurableQueue(newTestRateLimiter(), path)
+		So(q.Pending(), ShouldEqual, 0)
+		So(q.nextID, ShouldEqual, 3)
+	})
+
+	Convey("Unparsable records are skipped", t, func() {
+		path := filepath.Join(t.TempDir(), "jobs.wal")
+		_ = os.WriteFile(path, []byte(`{"op":"add","id":1,"handler":"echo"}
+{"op":"add","id":2,"hand
+{"op":"add","id":3,"handler":"echo"}
+{"op":"ack","id":1}
+`), 0o600)
+
+		q, err := NewDurableQueue(newTestRateLimiter(), path)
+		So(err, ShouldBeNil)
+		So(q.Pending(), ShouldEqual, 1)
+		So(q.pending, ShouldContainKey, uint64(3))
+		So(q.Close(), ShouldBeNil)
+
+		// the log is compacted without the unparsable record
+		q, _ = NewDurableQueue(newTestRateLimiter(), path)
+		So(q.pending, ShouldContainKey, uint64(3))
+		So(q.nextID, ShouldEqual, 4)
+	})
+
+	Convey("Jobs which weren't started stay pending", t, func() {
+		l, _ := NewRateLimiter(config.NewConfigWithQuotas([]*config.Quota{
+			config.NewQuota(1, time.Second),
+		}))
+		l.Start()
+		q, _ := NewDurableQueue(l, filepath.Join(t.TempDir(), "jobs.wal"))
+		q.Register("echo", echo)
+
+		ch, err := q.Submit("echo", []byte("foo"), WithWeight(2))
+		So(err, ShouldBeNil)
+		So((<-ch).Error, ShouldEqual, job.ErrWeightExceedsCapacity)
+		So(q.Pending(), ShouldEqual, 1)
+
+		// the job whose deadline has passed is never replayed
+		ch, _ = q.Submit("echo", []byte("bar"), WithTimeout(time.Nanosecond))
+		So(errors.Is((<-ch).Error, job.ErrJobExpired), ShouldBeTrue)
+		So(q.Pending(), ShouldEqual, 1)
+	})
+
+	Convey("Jobs answered without the handler are acknowledged", t, func() {
+		l := newTestRateLimiter()
+		q, _ := NewDurableQueue(l, filepath.Join(t.TempDir(), "jobs.wal"))
+		q.Register("echo", echo)
+
+		ch, _ := q.Submit("echo", []byte("foo"), WithCache("foo", time.Minute, 0))
+		So((<-ch).Result, ShouldEqual, "foo")
+
+		// the response from the cache
+		ch, _ = q.Submit("echo", []byte("foo"), WithCache("foo", time.Minute, 0))
+		So((<-ch).Result, ShouldEqual, "foo")
+		So(q.Pending(), ShouldEqual, 0)
+
+		// the follower of the shared job
+		l, _ = NewRateLimiter(config.NewConfig())
+		q, _ = NewDurableQueue(l, filepath.Join(t.TempDir(), "jobs.wal"))
+		q.Register("echo", echo)
+
+		leader, _ := q.Submit("echo", []byte("bar"), WithDedupKey("bar"))
+		follower, _ := q.Submit("echo", []byte("bar"), WithDedupKey("bar"))
+		l.Start()
+		So((<-leader).Result, ShouldEqual, "bar")
+		So((<-follower).Result, ShouldEqual, "bar")
+		So(q.Pending(), ShouldEqual, 0)
+	})
+
+	Convey("Jobs rejected by the open circuit breaker stay pending", t, func() {
+		cfg := config.NewConfig()
+		cfg.CircuitBreaker = config.NewCircuitBreaker(1, time.Hour)
+		l, _ := NewRateLimiter(cfg)
+		l.Start()
+		q, _ := NewDurableQueue(l, filepath.Join(t.TempDir(), "jobs.wal"))
+		q.Register("fail", func(ctx context.Context, payload []byte) (interface{}, error) {
+			return nil, errors.New("upstream is down")
+		})
+
+		ch, _ := q.Submit("fail", nil)
+		So((<-ch).Error, ShouldBeError)
+		So(q.Pending(), ShouldEqual, 0)
+
+		ch, _ = q.Submit("fail", nil)
+		So((<-ch).Error, ShouldEqual, job.ErrCircuitOpen)
+		So(q.Pending(), ShouldEqual, 1)
+	})
+
+	Convey("Options of the job are replayed", t, func() {
+		path := filepath.Join(t.TempDir(), "jobs.wal")
+
+		// the limiter is not started, so jobs are never completed
+		l, _ := NewRateLimiter(config.NewConfig())
+		q, _ := NewDurableQueue(l, path)
+		q.Register("echo", echo)
+		_, _ = q.Submit("echo", []byte("foo"),
+			WithKey("key"), WithPath("account", "orders"), WithTenant("alice"), WithWeight(2), WithTimeout(time.Hour))
+		So(q.Close(), ShouldBeNil)
+
+		q, _ = NewDurableQueue(newTestRateLimiter(), path)
+		q.Register("echo", echo)
+
+		r := job.Request{}
+		for _, opt := range q.pending[1].options() {
+			opt(&r)
+		}
+		So(r.Key, ShouldEqual, "key")
+		So(r.Path, ShouldResemble, []string{"account", "orders"})
+		So(r.Tenant, ShouldEqual, "alice")
+		So(r.Weight, ShouldEqual, 2)
+		So(r.ExpiredAt, ShouldHappenWithin, time.Minute, time.Now().Add(time.Hour))
+
+		// jobs submitted before the replay aren't replayed
+		_, _ = q.Submit("echo", []byte("bar"))
+
+		n, err := q.Replay()
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 1)
+	})
+
+	Convey("Unknown handler", t, func() {
+		q, _ := NewDurableQueue(newTestRateLimiter(), filepath.Join(t.TempDir(), "jobs.wal"))
+
+		_, err := q.Submit("echo", nil)
+		So(errors.Is(err, ErrUnknownHandler), ShouldBeTrue)
+		So(q.Pending(), ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,65 @@
+package limiter
+
+import (
+	"sort"
+	"time"
+
+	"github.com/chatex-com/rate-limiter/internal/worker"
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+// EstimateWait predicts the duration till a job with the weight submitted now
+// would be started. It simulates reservations of jobs taken by workers which wait
+// for a free slot and of queued jobs by release times of time window quotas.
+// Key and concurrency quotas are not considered.
+func (l *RateLimiter) EstimateWait(weight uint) (time.Duration, error) {
+	r := job.Request{Weight: weight}
+	if !l.fits(r) {
+		return 0, job.ErrWeightExceedsCapacity
+	}
+
+	var weights []uint
+	for _, w := range l.waiting() {
+		weights = append(weights, w.Request.Slots())
+	}
+
+	weights = append(weights, l.queue.Weights()...)
+	weights = append(weights, r.Slots())
+
+	return l.quotas.Estimate(weights), nil
+}
+
+// QueuePosition returns 1-based position of the submitted job in the queue.
+// Jobs taken by workers which wait for a free slot are ahead of the queue.
+// It returns false if the job was already started or completed.
+func (l *RateLimiter) QueuePosition(ch <-chan job.Response) (int, bool) {
+	waiting := l.waiting()
+	for i, w := range waiting {
+		if w.Request.Ch == ch {
+			return i + 1, true
+		}
+	}
+
+	pos, ok := l.queue.Position(ch)
+	if !ok {
+		return 0, false
+	}
+
+	return len(waiting) + pos, true
+}
+
+// waiting returns requests taken by workers which aren't started yet in the order they were taken
+func (l *RateLimiter) waiting() []worker.Waiting {
+	var waiting []worker.Waiting
+	for _, w := range l.workers {
+		if r, ok := w.Waiting(); ok {
+			waiting = append(waiting, r)
+		}
+	}
+
+	sort.Slice(waiting, func(i, j int) bool {
+		return waiting[i].Since.Before(waiting[j].Since)
+	})
+
+	return waiting
+}
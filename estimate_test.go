@@ -0,0 +1,98 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/chatex-com/rate-limiter/pkg/config"
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+func TestEstimateWait(t *testing.T) {
+	Convey("Queued jobs are considered", t, func() {
+		cfg := config.NewConfigWithQuotas([]*config.Quota{
+			config.NewQuota(2, time.Second),
+		})
+		l, _ := NewRateLimiter(cfg)
+
+		wait, err := l.EstimateWait(2)
+		So(err, ShouldBeNil)
+		So(wait, ShouldEqual, 0)
+
+		noop := func() (interface{}, error) {
+			return nil, nil
+		}
+		l.Execute(noop)
+		l.ExecuteWithOptions(noop, WithWeight(2))
+
+		wait, _ = l.EstimateWait(1)
+		So(wait, ShouldAlmostEqual, 2*time.Second, 10*time.Millisecond)
+	})
+
+	Convey("Jobs taken by workers are considered", t, func() {
+		cfg := config.NewConfigWithQuotas([]*config.Quota{
+			config.NewQuota(1, 500*time.Millisecond),
+		})
+		l, _ := NewRateLimiter(cfg)
+		l.Start()
+		defer l.Stop()
+
+		noop := func() (interface{}, error) {
+			return nil, nil
+		}
+		<-l.Execute(noop)
+		ch := l.Execute(noop)
+		time.Sleep(20 * time.Millisecond)
+
+		pos, ok := l.QueuePosition(ch)
+		So(ok, ShouldBeTrue)
+		So(pos, ShouldEqual, 1)
+
+		wait, _ := l.EstimateWait(1)
+		So(wait, ShouldAlmostEqual, 980*time.Millisecond, 20*time.Millisecond)
+
+		<-ch
+
+		_, ok = l.QueuePosition(ch)
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Weight exceeds capacity", t, func() {
+		cfg := config.NewConfigWithQuotas([]*config.Quota{
+			config.NewQuota(2, time.Second),
+		})
+		l, _ := NewRateLimiter(cfg)
+
+		_, err := l.EstimateWait(3)
+		So(err, ShouldEqual, job.ErrWeightExceedsCapacity)
+
+		resp := <-l.ExecuteWithOptions(func() (interface{}, error) {
+			return nil, nil
+		}, WithWeight(3))
+		So(resp.Error, ShouldEqual, job.ErrWeightExceedsCapacity)
+	})
+}
+
+func TestQueuePosition(t *testing.T) {
+	Convey("Position of the queued job", t, func() {
+		l, _ := NewRateLimiter(config.NewConfig())
+
+		noop := func() (interface{}, error) {
+			return nil, nil
+		}
+		l.Execute(noop)
+		ch := l.Execute(noop)
+
+		pos, ok := l.QueuePosition(ch)
+		So(ok, ShouldBeTrue)
+		So(pos, ShouldEqual, 2)
+
+		l.Start()
+		<-ch
+
+		_, ok = l.QueuePosition(ch)
+		So(ok, ShouldBeFalse)
+	})
+}
@@ -0,0 +1,137 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+var ErrNoFutures = errors.New("no futures to wait")
+
+// Future is a typed result of the job which will be available after execution
+type Future[T any] struct {
+	done   chan struct{}
+	result T
+	err    error
+}
+
+// Submit executes the typed job with the rate limiter. The job receives the context
+// set by WithContext option or background context otherwise.
+func Submit[T any](l *RateLimiter, fn func(ctx context.Context) (T, error), opts ...Option) *Future[T] {
+	ch := l.execute(job.Request{
+		ContextJob: func(ctx context.Context) (interface{}, error) {
+			return fn(ctx)
+		},
+	}, opts)
+
+	f := newFuture[T]()
+
+	go func() {
+		resp := <-ch
+		result, _ := resp.Result.(T)
+
+		f.resolve(result, resp.Error)
+	}()
+
+	return f
+}
+
+func newFuture[T any]() *Future[T] {
+	return &Future[T]{
+		done: make(chan struct{}),
+	}
+}
+
+// Done returns the channel which is closed when the result is available
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Get waits for the result of the job or for the context to be done
+func (f *Future[T]) Get(ctx context.Context) (T, error) {
+	select {
+	case <-f.done:
+		return f.result, f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+func (f *Future[T]) resolve(result T, err error) {
+	f.result = result
+	f.err = err
+
+	close(f.done)
+}
+
+// All returns the future of results of all futures in the same order.
+// It's failed with the first error of any future.
+func All[T any](futures ...*Future[T]) *Future[[]T] {
+	f := newFuture[[]T]()
+
+	go func() {
+		results := make([]T, len(futures))
+		errs := make(chan error, len(futures))
+
+		for i, future := range futures {
+			go func(i int, future *Future[T]) {
+				<-future.done
+				results[i] = future.result
+				errs <- future.err
+			}(i, future)
+		}
+
+		for range futures {
+			if err := <-errs; err != nil {
+				f.resolve(nil, err)
+				return
+			}
+		}
+
+		f.resolve(results, nil)
+	}()
+
+	return f
+}
+
+// Any returns the future of the first successful result.
+// It's failed with the last error if all futures are failed.
+func Any[T any](futures ...*Future[T]) *Future[T] {
+	f := newFuture[T]()
+
+	if len(futures) == 0 {
+		var zero T
+		f.resolve(zero, ErrNoFutures)
+
+		return f
+	}
+
+	go func() {
+		done := make(chan *Future[T], len(futures))
+
+		for _, future := range futures {
+			go func(future *Future[T]) {
+				<-future.done
+				done <- future
+			}(future)
+		}
+
+		var err error
+		for range futures {
+			future := <-done
+			if future.err == nil {
+				f.resolve(future.result, nil)
+				return
+			}
+
+			err = future.err
+		}
+
+		var zero T
+		f.resolve(zero, err)
+	}()
+
+	return f
+}
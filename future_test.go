@@ -0,0 +1,123 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/chatex-com/rate-limiter/pkg/config"
+)
+
+func newTestRateLimiter() *RateLimiter {
+	cfg := config.NewConfig()
+	cfg.Concurrency = 2
+	l, _ := NewRateLimiter(cfg)
+	l.Start()
+
+	return l
+}
+
+func resolved[T any](result T, err error) *Future[T] {
+	f := newFuture[T]()
+	f.resolve(result, err)
+
+	return f
+}
+
+func TestSubmit(t *testing.T) {
+	Convey("Typed result", t, func() {
+		l := newTestRateLimiter()
+
+		f := Submit(l, func(ctx context.Context) (int, error) {
+			return 42, nil
+		})
+
+		<-f.Done()
+		result, err := f.Get(context.Background())
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, 42)
+	})
+
+	Convey("Error with zero result", t, func() {
+		l := newTestRateLimiter()
+
+		f := Submit(l, func(ctx context.Context) (*int, error) {
+			return nil, errors.New("error")
+		})
+
+		result, err := f.Get(context.Background())
+		So(err, ShouldBeError)
+		So(result, ShouldBeNil)
+	})
+
+	Convey("Job receives context of the request", t, func() {
+		type key struct{}
+		l := newTestRateLimiter()
+		ctx := context.WithValue(context.Background(), key{}, "foo")
+
+		f := Submit(l, func(ctx context.Context) (string, error) {
+			return ctx.Value(key{}).(string), nil
+		}, WithContext(ctx))
+
+		result, _ := f.Get(context.Background())
+		So(result, ShouldEqual, "foo")
+	})
+
+	Convey("Get is canceled by context", t, func() {
+		f := newFuture[int]()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+
+		_, err := f.Get(ctx)
+		So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+	})
+}
+
+func TestAll(t *testing.T) {
+	Convey("All results in order", t, func() {
+		results, err := All(resolved(1, nil), resolved(2, nil)).Get(context.Background())
+
+		So(err, ShouldBeNil)
+		So(results, ShouldResemble, []int{1, 2})
+	})
+
+	Convey("Failed with error", t, func() {
+		pending := newFuture[int]()
+		results, err := All(pending, resolved(0, errors.New("error"))).Get(context.Background())
+
+		So(err, ShouldBeError)
+		So(results, ShouldBeNil)
+	})
+
+	Convey("Empty list", t, func() {
+		results, err := All[int]().Get(context.Background())
+
+		So(err, ShouldBeNil)
+		So(results, ShouldBeEmpty)
+	})
+}
+
+func TestAny(t *testing.T) {
+	Convey("First successful result", t, func() {
+		pending := newFuture[int]()
+		result, err := Any(resolved(0, errors.New("error")), pending, resolved(2, nil)).Get(context.Background())
+
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, 2)
+	})
+
+	Convey("All futures are failed", t, func() {
+		_, err := Any(resolved(0, errors.New("error")), resolved(0, errors.New("error"))).Get(context.Background())
+
+		So(err, ShouldBeError)
+	})
+
+	Convey("Empty list", t, func() {
+		_, err := Any[int]().Get(context.Background())
+
+		So(err, ShouldEqual, ErrNoFutures)
+	})
+}
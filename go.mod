@@ -1,5 +1,10 @@
 module github.com/chatex-com/rate-limiter
 
-go 1.13
+go 1.21
 
 require github.com/smartystreets/goconvey v1.6.4
+
+require (
+	github.com/jtolds/gls v4.20.0+incompatible // indirect
+	github.com/smartystreets/assertions v0.0.0-20180927180507-b2de0cb4f26d // indirect
+)
@@ -0,0 +1,116 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/chatex-com/rate-limiter/pkg/config"
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+func TestInterceptors(t *testing.T) {
+	Convey("Limiter interceptors are run before interceptors of the request", t, func() {
+		cfg := config.NewConfigWithQuotas([]*config.Quota{
+			config.NewQuota(10, time.Second),
+		})
+		l, _ := NewRateLimiter(cfg)
+		l.Start()
+
+		var (
+			calls []string
+			mu    sync.Mutex
+		)
+		trace := func(name string) job.Interceptor {
+			return func(next job.ContextJob) job.ContextJob {
+				return func(ctx context.Context) (interface{}, error) {
+					mu.Lock()
+					calls = append(calls, name)
+					mu.Unlock()
+
+					return next(ctx)
+				}
+			}
+		}
+
+		l.Use(trace("first"), trace("second"))
+
+		ch := l.ExecuteWithOptions(func() (interface{}, error) {
+			return "foo", nil
+		}, WithInterceptors(trace("request")))
+
+		resp := <-ch
+		So(resp.Error, ShouldBeNil)
+		So(resp.Result, ShouldEqual, "foo")
+		So(calls, ShouldResemble, []string{"first", "second", "request"})
+
+		ch, err := l.TryExecute(func() (interface{}, error) {
+			return "bar", nil
+		})
+		So(err, ShouldBeNil)
+		So((<-ch).Result, ShouldEqual, "bar")
+		So(calls, ShouldResemble, []string{"first", "second", "request", "first", "second"})
+	})
+
+	Convey("Interceptor can map the result and the error", t, func() {
+		cfg := config.NewConfigWithQuotas([]*config.Quota{
+			config.NewQuota(10, time.Second),
+		})
+		l, _ := NewRateLimiter(cfg)
+		l.Start()
+
+		errUpstream := errors.New("upstream")
+		l.Use(func(next job.ContextJob) job.ContextJob {
+			return func(ctx context.Context) (interface{}, error) {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+
+				result, err := next(ctx)
+				if errors.Is(err, errUpstream) {
+					return "fallback", nil
+				}
+
+				return result, err
+			}
+		})
+
+		resp := <-l.Execute(func() (interface{}, error) {
+			return nil, errUpstream
+		})
+		So(resp.Error, ShouldBeNil)
+		So(resp.Result, ShouldEqual, "fallback")
+	})
+
+	Convey("Interceptors of the cached job are run once", t, func() {
+		cfg := config.NewConfigWithQuotas([]*config.Quota{
+			config.NewQuota(10, time.Second),
+		})
+		l, _ := NewRateLimiter(cfg)
+		l.Start()
+
+		var calls int32
+		l.Use(func(next job.ContextJob) job.ContextJob {
+			return func(ctx context.Context) (interface{}, error) {
+				atomic.AddInt32(&calls, 1)
+
+				return next(ctx)
+			}
+		})
+
+		noop := func() (interface{}, error) {
+			return "foo", nil
+		}
+		So((<-l.ExecuteWithOptions(noop, WithCache("foo", time.Minute, 0))).Result, ShouldEqual, "foo")
+		So(atomic.LoadInt32(&calls), ShouldEqual, 1)
+
+		// the cached response doesn't run the job
+		So((<-l.ExecuteWithOptions(noop, WithCache("foo", time.Minute, 0))).Result, ShouldEqual, "foo")
+		So(atomic.LoadInt32(&calls), ShouldEqual, 1)
+	})
+}
@@ -0,0 +1,147 @@
+package adaptive
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/chatex-com/rate-limiter/pkg/config"
+)
+
+var (
+	ErrWrongBounds          = errors.New("adaptive.MinConcurrency must be positive and not greater than adaptive.MaxConcurrency")
+	ErrWrongBackoff         = errors.New("adaptive.Backoff must be in (0, 1)")
+	ErrZeroLatencyThreshold = errors.New("adaptive.LatencyThreshold must be a positive value")
+)
+
+// Limiter limits the number of jobs in flight with AIMD algorithm:
+// the limit grows by one per limit successful jobs and is multiplied
+// by backoff on error or on latency above the threshold.
+type Limiter struct {
+	cfg          config.Adaptive
+	limit        float64
+	inFlight     uint32
+	lastDecrease time.Time
+	mu           sync.Mutex
+	// released is closed and replaced when a slot is freed or the limit is changed
+	released chan struct{}
+}
+
+func NewLimiter(cfg config.Adaptive) (*Limiter, error) {
+	if cfg.MinConcurrency == 0 || cfg.MinConcurrency > cfg.MaxConcurrency {
+		return nil, ErrWrongBounds
+	}
+
+	if cfg.Backoff <= 0 || cfg.Backoff >= 1 {
+		return nil, ErrWrongBackoff
+	}
+
+	if cfg.LatencyThreshold <= 0 {
+		return nil, ErrZeroLatencyThreshold
+	}
+
+	l := &Limiter{
+		cfg:      cfg,
+		limit:    float64(cfg.MinConcurrency),
+		released: make(chan struct{}),
+	}
+
+	return l, nil
+}
+
+// Acquire blocks till the number of jobs in flight is less than the current limit.
+// It returns false if the stop channel is closed before the slot is acquired.
+func (l *Limiter) Acquire(stop <-chan struct{}) bool {
+	for {
+		l.mu.Lock()
+		if l.inFlight < uint32(l.limit) {
+			l.inFlight++
+			l.mu.Unlock()
+
+			return true
+		}
+		released := l.released
+		l.mu.Unlock()
+
+		select {
+		case <-released:
+		case <-stop:
+			return false
+		}
+	}
+}
+
+// TryAcquire takes the slot if the number of jobs in flight is less than the current limit
+func (l *Limiter) TryAcquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.inFlight >= uint32(l.limit) {
+		return false
+	}
+
+	l.inFlight++
+
+	return true
+}
+
+// Release frees the slot and adjusts the limit by the job latency and error
+func (l *Limiter) Release(latency time.Duration, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight--
+
+	if err != nil || latency > l.cfg.LatencyThreshold {
+		l.decrease()
+	} else {
+		l.increase()
+	}
+
+	l.notify()
+}
+
+// Cancel frees the slot without adjusting the limit (e.g. job wasn't executed)
+func (l *Limiter) Cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight--
+
+	l.notify()
+}
+
+func (l *Limiter) Limit() uint32 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return uint32(l.limit)
+}
+
+// notify wakes up waiters of slots
+func (l *Limiter) notify() {
+	close(l.released)
+	l.released = make(chan struct{})
+}
+
+func (l *Limiter) increase() {
+	l.limit += 1 / l.limit
+
+	if max := float64(l.cfg.MaxConcurrency); l.limit > max {
+		l.limit = max
+	}
+}
+
+func (l *Limiter) decrease() {
+	// jobs started before the previous decrease must not decrease the limit again
+	if time.Since(l.lastDecrease) < l.cfg.LatencyThreshold {
+		return
+	}
+
+	l.lastDecrease = time.Now()
+	l.limit *= l.cfg.Backoff
+
+	if min := float64(l.cfg.MinConcurrency); l.limit < min {
+		l.limit = min
+	}
+}
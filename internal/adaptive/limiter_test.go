@@ -0,0 +1,124 @@
+package adaptive
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/chatex-com/rate-limiter/pkg/config"
+)
+
+func TestNewLimiter(t *testing.T) {
+	Convey("Wrong bounds", t, func() {
+		l, err := NewLimiter(*config.NewAdaptive(0, 10, time.Second))
+		So(l, ShouldBeNil)
+		So(err, ShouldEqual, ErrWrongBounds)
+
+		l, err = NewLimiter(*config.NewAdaptive(10, 1, time.Second))
+		So(l, ShouldBeNil)
+		So(err, ShouldEqual, ErrWrongBounds)
+	})
+
+	Convey("Wrong backoff", t, func() {
+		cfg := config.NewAdaptive(1, 10, time.Second)
+		cfg.Backoff = 1
+		l, err := NewLimiter(*cfg)
+
+		So(l, ShouldBeNil)
+		So(err, ShouldEqual, ErrWrongBackoff)
+	})
+
+	Convey("Zero latency threshold", t, func() {
+		l, err := NewLimiter(*config.NewAdaptive(1, 10, 0))
+
+		So(l, ShouldBeNil)
+		So(err, ShouldEqual, ErrZeroLatencyThreshold)
+	})
+
+	Convey("Success creation", t, func() {
+		l, err := NewLimiter(*config.NewAdaptive(2, 10, time.Second))
+
+		So(err, ShouldBeNil)
+		So(l.Limit(), ShouldEqual, 2)
+	})
+}
+
+func TestAdjustLimit(t *testing.T) {
+	Convey("Additive increase up to max", t, func() {
+		l, _ := NewLimiter(*config.NewAdaptive(1, 3, time.Second))
+
+		for i := 0; i < 10; i++ {
+			l.Acquire(nil)
+			l.Release(time.Millisecond, nil)
+		}
+
+		So(l.Limit(), ShouldEqual, 3)
+	})
+
+	Convey("Multiplicative decrease down to min", t, func() {
+		cfg := config.NewAdaptive(2, 100, time.Second)
+		cfg.Backoff = 0.5
+		l, _ := NewLimiter(*cfg)
+		l.limit = 40
+
+		l.Acquire(nil)
+		l.Release(time.Millisecond, errors.New("error"))
+		So(l.Limit(), ShouldEqual, 20)
+
+		// the second decrease within the threshold interval is ignored
+		l.Acquire(nil)
+		l.Release(2*time.Second, nil)
+		So(l.Limit(), ShouldEqual, 20)
+
+		l.lastDecrease = time.Time{}
+		l.limit = 3
+		l.Acquire(nil)
+		l.Release(2*time.Second, nil)
+		So(l.Limit(), ShouldEqual, 2)
+	})
+
+	Convey("Acquire blocks till release", t, func() {
+		l, _ := NewLimiter(*config.NewAdaptive(1, 1, time.Second))
+		l.Acquire(nil)
+
+		acquired := make(chan struct{})
+		go func() {
+			l.Acquire(nil)
+			close(acquired)
+		}()
+
+		select {
+		case <-acquired:
+			t.Fatal("slot must not be acquired")
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		l.Cancel()
+		<-acquired
+
+		So(l.inFlight, ShouldEqual, 1)
+	})
+
+	Convey("TryAcquire doesn't block", t, func() {
+		l, _ := NewLimiter(*config.NewAdaptive(1, 1, time.Second))
+
+		So(l.TryAcquire(), ShouldBeTrue)
+		So(l.TryAcquire(), ShouldBeFalse)
+
+		l.Cancel()
+		So(l.TryAcquire(), ShouldBeTrue)
+	})
+
+	Convey("Acquire is interrupted by the stop channel", t, func() {
+		l, _ := NewLimiter(*config.NewAdaptive(1, 1, time.Second))
+		So(l.Acquire(nil), ShouldBeTrue)
+
+		stop := make(chan struct{})
+		close(stop)
+
+		So(l.Acquire(stop), ShouldBeFalse)
+		So(l.inFlight, ShouldEqual, 1)
+	})
+}
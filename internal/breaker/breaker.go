@@ -0,0 +1,221 @@
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/chatex-com/rate-limiter/pkg/config"
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+var (
+	ErrNoTripCondition    = errors.New("circuitBreaker.ConsecutiveFailures or circuitBreaker.ErrorRatio must be set")
+	ErrWrongErrorRatio    = errors.New("circuitBreaker.ErrorRatio must be in [0, 1]")
+	ErrZeroWindow         = errors.New("circuitBreaker.Window must be a positive value")
+	ErrZeroOpenTimeout    = errors.New("circuitBreaker.OpenTimeout must be a positive value")
+	ErrZeroHalfOpenProbes = errors.New("circuitBreaker.HalfOpenProbes must be a positive value")
+)
+
+type State uint8
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+// Breaker is a circuit breaker for a single upstream.
+//
+// Every state change starts a new generation. Results of jobs allowed
+// in the previous generation are ignored.
+type Breaker struct {
+	cfg        config.CircuitBreaker
+	state      State
+	generation uint64
+	openedAt   time.Time
+
+	// closed state counters
+	consecutive uint32
+	windowStart time.Time
+	total       uint32
+	failed      uint32
+
+	// half-open state counters
+	probes    uint32
+	succeeded uint32
+
+	mu sync.Mutex
+}
+
+func Validate(cfg config.CircuitBreaker) error {
+	if cfg.ConsecutiveFailures == 0 && cfg.ErrorRatio == 0 {
+		return ErrNoTripCondition
+	}
+
+	if cfg.ErrorRatio < 0 || cfg.ErrorRatio > 1 {
+		return ErrWrongErrorRatio
+	}
+
+	if cfg.ErrorRatio > 0 && cfg.Window <= 0 {
+		return ErrZeroWindow
+	}
+
+	if cfg.OpenTimeout <= 0 {
+		return ErrZeroOpenTimeout
+	}
+
+	if cfg.HalfOpenProbes == 0 {
+		return ErrZeroHalfOpenProbes
+	}
+
+	return nil
+}
+
+func NewBreaker(cfg config.CircuitBreaker) (*Breaker, error) {
+	if err := Validate(cfg); err != nil {
+		return nil, err
+	}
+
+	b := &Breaker{
+		cfg:         cfg,
+		windowStart: time.Now(),
+	}
+
+	return b, nil
+}
+
+// IsOpen reports whether jobs are failed without execution
+func (b *Breaker) IsOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.currentState() == StateOpen
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.currentState()
+}
+
+// Allow checks if the job can be executed. The returned generation
+// must be passed to Done or Cancel.
+func (b *Breaker) Allow() (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.currentState() {
+	case StateOpen:
+		return 0, job.ErrCircuitOpen
+	case StateHalfOpen:
+		if b.probes >= b.cfg.HalfOpenProbes {
+			return 0, job.ErrCircuitOpen
+		}
+
+		b.probes++
+	}
+
+	return b.generation, nil
+}
+
+// Done records the result of the job execution
+func (b *Breaker) Done(generation uint64, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+
+	switch b.state {
+	case StateClosed:
+		b.record(err)
+	case StateHalfOpen:
+		if err != nil {
+			b.open()
+			return
+		}
+
+		b.succeeded++
+		if b.succeeded >= b.cfg.HalfOpenProbes {
+			b.close()
+		}
+	}
+}
+
+// Cancel returns the probe back if the job wasn't executed
+func (b *Breaker) Cancel(generation uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation == b.generation && b.state == StateHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// idle checks if the breaker is closed and has no failures within the window
+func (b *Breaker) idle() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.currentState() != StateClosed || b.consecutive > 0 {
+		return false
+	}
+
+	return b.failed == 0 || (b.cfg.Window > 0 && time.Since(b.windowStart) > b.cfg.Window)
+}
+
+func (b *Breaker) currentState() State {
+	if b.state == StateOpen && time.Since(b.openedAt) >= b.cfg.OpenTimeout {
+		b.state = StateHalfOpen
+		b.generation++
+		b.probes = 0
+		b.succeeded = 0
+	}
+
+	return b.state
+}
+
+func (b *Breaker) record(err error) {
+	if b.cfg.Window > 0 && time.Since(b.windowStart) > b.cfg.Window {
+		b.windowStart = time.Now()
+		b.total = 0
+		b.failed = 0
+	}
+
+	b.total++
+
+	if err == nil {
+		b.consecutive = 0
+	} else {
+		b.consecutive++
+		b.failed++
+	}
+
+	if b.cfg.ConsecutiveFailures > 0 && b.consecutive >= b.cfg.ConsecutiveFailures {
+		b.open()
+		return
+	}
+
+	if b.cfg.ErrorRatio > 0 && b.total >= b.cfg.MinRequests &&
+		float64(b.failed)/float64(b.total) >= b.cfg.ErrorRatio {
+		b.open()
+	}
+}
+
+func (b *Breaker) open() {
+	b.state = StateOpen
+	b.generation++
+	b.openedAt = time.Now()
+}
+
+func (b *Breaker) close() {
+	b.state = StateClosed
+	b.generation++
+	b.consecutive = 0
+	b.windowStart = time.Now()
+	b.total = 0
+	b.failed = 0
+}
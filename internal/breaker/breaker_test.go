@@ -0,0 +1,143 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/chatex-com/rate-limiter/pkg/config"
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+var errUpstream = errors.New("upstream error")
+
+func TestNewBreaker(t *testing.T) {
+	Convey("Wrong configuration", t, func() {
+		_, err := NewBreaker(config.CircuitBreaker{OpenTimeout: time.Second, HalfOpenProbes: 1})
+		So(err, ShouldEqual, ErrNoTripCondition)
+
+		_, err = NewBreaker(config.CircuitBreaker{ErrorRatio: 2})
+		So(err, ShouldEqual, ErrWrongErrorRatio)
+
+		_, err = NewBreaker(config.CircuitBreaker{ErrorRatio: 0.5})
+		So(err, ShouldEqual, ErrZeroWindow)
+
+		_, err = NewBreaker(config.CircuitBreaker{ConsecutiveFailures: 1})
+		So(err, ShouldEqual, ErrZeroOpenTimeout)
+
+		_, err = NewBreaker(config.CircuitBreaker{ConsecutiveFailures: 1, OpenTimeout: time.Second})
+		So(err, ShouldEqual, ErrZeroHalfOpenProbes)
+	})
+
+	Convey("Success creation", t, func() {
+		b, err := NewBreaker(*config.NewCircuitBreaker(3, time.Second))
+
+		So(err, ShouldBeNil)
+		So(b.State(), ShouldEqual, StateClosed)
+	})
+}
+
+func TestConsecutiveFailures(t *testing.T) {
+	Convey("Open after failures in a row", t, func() {
+		b, _ := NewBreaker(*config.NewCircuitBreaker(2, time.Hour))
+
+		gen, _ := b.Allow()
+		b.Done(gen, errUpstream)
+		gen, _ = b.Allow()
+		b.Done(gen, nil)
+		gen, _ = b.Allow()
+		b.Done(gen, errUpstream)
+		So(b.IsOpen(), ShouldBeFalse)
+
+		gen, _ = b.Allow()
+		b.Done(gen, errUpstream)
+		So(b.IsOpen(), ShouldBeTrue)
+
+		_, err := b.Allow()
+		So(err, ShouldEqual, job.ErrCircuitOpen)
+	})
+}
+
+func TestErrorRatio(t *testing.T) {
+	Convey("Open on error ratio", t, func() {
+		b, _ := NewBreaker(config.CircuitBreaker{
+			ErrorRatio:     0.5,
+			MinRequests:    4,
+			Window:         time.Minute,
+			OpenTimeout:    time.Hour,
+			HalfOpenProbes: 1,
+		})
+
+		for _, err := range []error{errUpstream, nil, errUpstream} {
+			gen, _ := b.Allow()
+			b.Done(gen, err)
+		}
+		So(b.IsOpen(), ShouldBeFalse)
+
+		gen, _ := b.Allow()
+		b.Done(gen, nil)
+		So(b.IsOpen(), ShouldBeTrue)
+	})
+}
+
+func TestHalfOpen(t *testing.T) {
+	Convey("Close after successful probes", t, func() {
+		cfg := config.NewCircuitBreaker(1, 10*time.Millisecond)
+		cfg.HalfOpenProbes = 2
+		b, _ := NewBreaker(*cfg)
+
+		old, _ := b.Allow()
+		gen, _ := b.Allow()
+		b.Done(gen, errUpstream)
+		So(b.State(), ShouldEqual, StateOpen)
+
+		time.Sleep(20 * time.Millisecond)
+		So(b.State(), ShouldEqual, StateHalfOpen)
+
+		p1, err := b.Allow()
+		So(err, ShouldBeNil)
+		p2, err := b.Allow()
+		So(err, ShouldBeNil)
+		_, err = b.Allow()
+		So(err, ShouldEqual, job.ErrCircuitOpen)
+
+		// result of the job allowed before opening is ignored
+		b.Done(old, errUpstream)
+		So(b.State(), ShouldEqual, StateHalfOpen)
+
+		b.Done(p1, nil)
+		So(b.State(), ShouldEqual, StateHalfOpen)
+		b.Done(p2, nil)
+		So(b.State(), ShouldEqual, StateClosed)
+	})
+
+	Convey("Open again on failed probe", t, func() {
+		b, _ := NewBreaker(*config.NewCircuitBreaker(1, 10*time.Millisecond))
+
+		gen, _ := b.Allow()
+		b.Done(gen, errUpstream)
+		time.Sleep(20 * time.Millisecond)
+
+		gen, _ = b.Allow()
+		b.Done(gen, errUpstream)
+		So(b.State(), ShouldEqual, StateOpen)
+	})
+
+	Convey("Canceled probe is returned", t, func() {
+		b, _ := NewBreaker(*config.NewCircuitBreaker(1, 10*time.Millisecond))
+
+		gen, _ := b.Allow()
+		b.Done(gen, errUpstream)
+		time.Sleep(20 * time.Millisecond)
+
+		gen, _ = b.Allow()
+		_, err := b.Allow()
+		So(err, ShouldEqual, job.ErrCircuitOpen)
+
+		b.Cancel(gen)
+		_, err = b.Allow()
+		So(err, ShouldBeNil)
+	})
+}
@@ -0,0 +1,122 @@
+package breaker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/chatex-com/rate-limiter/pkg/config"
+)
+
+// purgeInterval is the interval of eviction of idle breakers of keys
+const purgeInterval = time.Minute
+
+// Group holds the breaker of the limiter and breakers of every key.
+// Every job is checked and recorded by the breaker of the limiter
+// and by the breaker of its key.
+type Group struct {
+	cfg      config.CircuitBreaker
+	breakers map[string]*Breaker
+	purged   time.Time
+	mu       sync.Mutex
+}
+
+// Generation holds generations of the breakers which allowed the job
+type Generation struct {
+	limiter uint64
+	key     uint64
+}
+
+func NewGroup(cfg config.CircuitBreaker) (*Group, error) {
+	if err := Validate(cfg); err != nil {
+		return nil, err
+	}
+
+	g := &Group{
+		cfg:      cfg,
+		breakers: make(map[string]*Breaker),
+		purged:   time.Now(),
+	}
+
+	return g, nil
+}
+
+// Get returns the breaker of the key. Empty key is used for the limiter itself.
+func (g *Group) Get(key string) *Breaker {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if now := time.Now(); now.Sub(g.purged) > purgeInterval {
+		g.purge()
+		g.purged = now
+	}
+
+	b, ok := g.breakers[key]
+	if !ok {
+		// configuration was validated in NewGroup
+		b, _ = NewBreaker(g.cfg)
+		g.breakers[key] = b
+	}
+
+	return b
+}
+
+// IsOpen reports whether jobs of the key are failed without execution
+func (g *Group) IsOpen(key string) bool {
+	if g.Get("").IsOpen() {
+		return true
+	}
+
+	return key != "" && g.Get(key).IsOpen()
+}
+
+// Allow checks if the job of the key can be executed by both breakers.
+// The returned generation must be passed to Done or Cancel.
+func (g *Group) Allow(key string) (Generation, error) {
+	var (
+		gen Generation
+		err error
+	)
+
+	if gen.limiter, err = g.Get("").Allow(); err != nil {
+		return gen, err
+	}
+
+	if key == "" {
+		return gen, nil
+	}
+
+	if gen.key, err = g.Get(key).Allow(); err != nil {
+		g.Get("").Cancel(gen.limiter)
+
+		return gen, err
+	}
+
+	return gen, nil
+}
+
+// Done records the result of the job execution in both breakers
+func (g *Group) Done(key string, gen Generation, err error) {
+	g.Get("").Done(gen.limiter, err)
+
+	if key != "" {
+		g.Get(key).Done(gen.key, err)
+	}
+}
+
+// Cancel returns probes back to both breakers if the job wasn't executed
+func (g *Group) Cancel(key string, gen Generation) {
+	g.Get("").Cancel(gen.limiter)
+
+	if key != "" {
+		g.Get(key).Cancel(gen.key)
+	}
+}
+
+// purge evicts breakers of keys without recent failures, the lock must be held
+func (g *Group) purge() {
+	for key, b := range g.breakers {
+		if key != "" && b.idle() {
+			delete(g.breakers, key)
+		}
+	}
+}
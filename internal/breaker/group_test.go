@@ -0,0 +1,83 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/chatex-com/rate-limiter/pkg/config"
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+func TestGroup(t *testing.T) {
+	Convey("Wrong configuration", t, func() {
+		g, err := NewGroup(config.CircuitBreaker{})
+
+		So(g, ShouldBeNil)
+		So(err, ShouldEqual, ErrNoTripCondition)
+	})
+
+	Convey("Breaker per key", t, func() {
+		g, _ := NewGroup(*config.NewCircuitBreaker(1, time.Hour))
+
+		So(g.Get(""), ShouldEqual, g.Get(""))
+		So(g.Get("foo"), ShouldEqual, g.Get("foo"))
+		So(g.Get("foo"), ShouldNotEqual, g.Get("bar"))
+
+		gen, _ := g.Get("foo").Allow()
+		g.Get("foo").Done(gen, errUpstream)
+
+		So(g.Get("foo").IsOpen(), ShouldBeTrue)
+		So(g.Get("bar").IsOpen(), ShouldBeFalse)
+	})
+
+	Convey("Keyed jobs are recorded by the breaker of the limiter", t, func() {
+		g, _ := NewGroup(*config.NewCircuitBreaker(1, time.Hour))
+
+		gen, err := g.Allow("foo")
+		So(err, ShouldBeNil)
+		g.Done("foo", gen, errUpstream)
+
+		So(g.IsOpen("foo"), ShouldBeTrue)
+		So(g.IsOpen(""), ShouldBeTrue)
+		So(g.IsOpen("bar"), ShouldBeTrue)
+		So(g.Get("bar").IsOpen(), ShouldBeFalse)
+
+		_, err = g.Allow("bar")
+		So(err, ShouldEqual, job.ErrCircuitOpen)
+	})
+
+	Convey("Probe of the limiter is returned when the key breaker is open", t, func() {
+		cfg := *config.NewCircuitBreaker(1, time.Millisecond)
+		g, _ := NewGroup(cfg)
+
+		gen, _ := g.Allow("")
+		g.Done("", gen, errUpstream)
+		gen, _ = g.Allow("foo")
+		g.Done("foo", gen, errUpstream)
+		time.Sleep(2 * time.Millisecond)
+
+		// both breakers are half-open, the key breaker has no probes left
+		_, _ = g.Get("foo").Allow()
+		_, err := g.Allow("foo")
+		So(err, ShouldEqual, job.ErrCircuitOpen)
+		So(g.Get("").probes, ShouldEqual, 0)
+	})
+
+	Convey("Idle breakers of keys are evicted", t, func() {
+		g, _ := NewGroup(*config.NewCircuitBreaker(2, time.Hour))
+
+		gen, _ := g.Allow("foo")
+		g.Done("foo", gen, nil)
+		gen, _ = g.Allow("bar")
+		g.Done("bar", gen, errUpstream)
+
+		g.purged = time.Time{}
+		g.Get("")
+
+		So(g.breakers, ShouldContainKey, "")
+		So(g.breakers, ShouldContainKey, "bar")
+		So(g.breakers, ShouldNotContainKey, "foo")
+	})
+}
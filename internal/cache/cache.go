@@ -0,0 +1,133 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+// Interval of removing entries which can't be served even as stale ones
+const purgeInterval = time.Minute
+
+type State uint8
+
+const (
+	StateMiss State = iota
+	StateFresh
+	StateStale
+)
+
+type entry struct {
+	response   job.Response
+	expiredAt  time.Time
+	staleAt    time.Time
+	refreshing bool
+}
+
+// Cache keeps successful job responses for TTL and can serve them
+// as stale ones for additional stale TTL
+type Cache struct {
+	entries   map[string]*entry
+	lastPurge time.Time
+	mu        sync.Mutex
+
+	hits   int64
+	misses int64
+	stale  int64
+}
+
+func NewCache() *Cache {
+	return &Cache{
+		entries:   make(map[string]*entry),
+		lastPurge: time.Now(),
+	}
+}
+
+// Get returns the cached response and its state. Stale response is
+// returned only if the stale response is requested (e.g. quota is exhausted).
+func (c *Cache) Get(key string, allowStale bool) (job.Response, State) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	e, ok := c.entries[key]
+
+	switch {
+	case ok && now.Before(e.expiredAt):
+		atomic.AddInt64(&c.hits, 1)
+		return e.response, StateFresh
+	case ok && allowStale && now.Before(e.staleAt):
+		atomic.AddInt64(&c.stale, 1)
+		return e.response, StateStale
+	}
+
+	atomic.AddInt64(&c.misses, 1)
+
+	return job.Response{}, StateMiss
+}
+
+// StartRefresh marks the entry as being refreshed. It returns false
+// if the entry is already being refreshed or doesn't exist.
+func (c *Cache) StartRefresh(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok || e.refreshing {
+		return false
+	}
+
+	e.refreshing = true
+
+	return true
+}
+
+// FinishRefresh resets the refreshing mark of the entry (e.g. refresh was failed)
+func (c *Cache) FinishRefresh(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		e.refreshing = false
+	}
+}
+
+func (c *Cache) Set(key string, response job.Response, ttl, staleTTL time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.entries[key] = &entry{
+		response:  response,
+		expiredAt: now.Add(ttl),
+		staleAt:   now.Add(ttl + staleTTL),
+	}
+
+	if now.Sub(c.lastPurge) > purgeInterval {
+		c.purge(now)
+	}
+}
+
+func (c *Cache) Hits() int64 {
+	return atomic.LoadInt64(&c.hits)
+}
+
+func (c *Cache) Misses() int64 {
+	return atomic.LoadInt64(&c.misses)
+}
+
+func (c *Cache) Stale() int64 {
+	return atomic.LoadInt64(&c.stale)
+}
+
+func (c *Cache) purge(now time.Time) {
+	for key, e := range c.entries {
+		if !now.Before(e.staleAt) {
+			delete(c.entries, key)
+		}
+	}
+
+	c.lastPurge = now
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+func TestGet(t *testing.T) {
+	Convey("Miss, fresh and stale responses", t, func() {
+		c := NewCache()
+
+		_, state := c.Get("foo", true)
+		So(state, ShouldEqual, StateMiss)
+
+		c.Set("foo", job.Response{Result: 1}, 10*time.Millisecond, time.Hour)
+
+		resp, state := c.Get("foo", false)
+		So(state, ShouldEqual, StateFresh)
+		So(resp.Result, ShouldEqual, 1)
+
+		time.Sleep(20 * time.Millisecond)
+
+		_, state = c.Get("foo", false)
+		So(state, ShouldEqual, StateMiss)
+
+		resp, state = c.Get("foo", true)
+		So(state, ShouldEqual, StateStale)
+		So(resp.Result, ShouldEqual, 1)
+
+		So(c.Hits(), ShouldEqual, 1)
+		So(c.Misses(), ShouldEqual, 2)
+		So(c.Stale(), ShouldEqual, 1)
+	})
+}
+
+func TestRefresh(t *testing.T) {
+	Convey("Only one refresh at the same time", t, func() {
+		c := NewCache()
+
+		So(c.StartRefresh("foo"), ShouldBeFalse)
+
+		c.Set("foo", job.Response{}, time.Second, time.Second)
+
+		So(c.StartRefresh("foo"), ShouldBeTrue)
+		So(c.StartRefresh("foo"), ShouldBeFalse)
+
+		c.FinishRefresh("foo")
+		So(c.StartRefresh("foo"), ShouldBeTrue)
+
+		// new value resets the mark
+		c.Set("foo", job.Response{}, time.Second, time.Second)
+		So(c.StartRefresh("foo"), ShouldBeTrue)
+	})
+}
+
+func TestPurge(t *testing.T) {
+	Convey("Remove entries which can't be served", t, func() {
+		c := NewCache()
+		c.Set("foo", job.Response{}, time.Millisecond, 0)
+		c.Set("bar", job.Response{}, time.Hour, 0)
+
+		c.purge(time.Now().Add(time.Second))
+
+		So(c.entries, ShouldHaveLength, 1)
+		So(c.entries, ShouldContainKey, "bar")
+	})
+}
@@ -0,0 +1,145 @@
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chatex-com/rate-limiter/pkg/event"
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+// Emitter delivers events to the observer in a dedicated goroutine.
+// Events are dropped if the buffer is full, so a slow observer can't stall workers.
+// A panic of the observer is recovered and counted. Methods of a nil emitter do nothing.
+type Emitter struct {
+	observer  event.Observer
+	events    chan event.Event
+	done      chan struct{}
+	closeOnce sync.Once
+	dropped   int64
+	panics    int64
+}
+
+func NewEmitter(o event.Observer, buffer int) *Emitter {
+	e := &Emitter{
+		observer: o,
+		events:   make(chan event.Event, buffer),
+		done:     make(chan struct{}),
+	}
+
+	go e.loop()
+
+	return e
+}
+
+// Emit sends the event of the request to the observer
+func (e *Emitter) Emit(t event.Type, r job.Request, opts ...func(*event.Event)) {
+	if e == nil {
+		return
+	}
+
+	ev := event.Event{
+		Type:   t,
+		Time:   time.Now(),
+		Key:    r.Key,
+		Tenant: r.Tenant,
+	}
+
+	for _, opt := range opts {
+		opt(&ev)
+	}
+
+	select {
+	case <-e.done:
+		atomic.AddInt64(&e.dropped, 1)
+		return
+	default:
+	}
+
+	select {
+	case e.events <- ev:
+	default:
+		atomic.AddInt64(&e.dropped, 1)
+	}
+}
+
+// Dropped returns the number of events dropped because of the full buffer
+// or because the emitter is closed
+func (e *Emitter) Dropped() int64 {
+	if e == nil {
+		return 0
+	}
+
+	return atomic.LoadInt64(&e.dropped)
+}
+
+// Panics returns the number of panics of the observer
+func (e *Emitter) Panics() int64 {
+	if e == nil {
+		return 0
+	}
+
+	return atomic.LoadInt64(&e.panics)
+}
+
+// Close finishes the goroutine of the emitter. Events emitted after Close are dropped.
+func (e *Emitter) Close() {
+	if e == nil {
+		return
+	}
+
+	e.closeOnce.Do(func() {
+		close(e.done)
+	})
+}
+
+func (e *Emitter) loop() {
+	for {
+		select {
+		case ev := <-e.events:
+			e.observe(ev)
+		case <-e.done:
+			return
+		}
+	}
+}
+
+// observe passes the event to the observer and recovers its panic
+func (e *Emitter) observe(ev event.Event) {
+	defer func() {
+		if v := recover(); v != nil {
+			atomic.AddInt64(&e.panics, 1)
+		}
+	}()
+
+	e.observer.Observe(ev)
+}
+
+// WithWait sets the duration of waiting for a free slot
+func WithWait(wait time.Duration) func(*event.Event) {
+	return func(e *event.Event) {
+		e.Wait = wait
+	}
+}
+
+// WithLatency sets the duration of the job execution
+func WithLatency(latency time.Duration) func(*event.Event) {
+	return func(e *event.Event) {
+		e.Latency = latency
+	}
+}
+
+// WithErr sets the error of the job
+func WithErr(err error) func(*event.Event) {
+	return func(e *event.Event) {
+		e.Err = err
+	}
+}
+
+// WithPanic sets the value recovered from the panic
+func WithPanic(v interface{}) func(*event.Event) {
+	return func(e *event.Event) {
+		e.Panic = v
+	}
+}
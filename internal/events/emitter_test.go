@@ -0,0 +1,93 @@
+package events
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/chatex-com/rate-limiter/pkg/event"
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+func TestEmitter(t *testing.T) {
+	Convey("Events are delivered in order", t, func() {
+		observed := make(chan event.Event, 2)
+		e := NewEmitter(event.ObserverFunc(func(ev event.Event) {
+			observed <- ev
+		}), 10)
+
+		err := errors.New("foo")
+		r := job.Request{Key: "foo", Tenant: "bar"}
+		e.Emit(event.Started, r)
+		e.Emit(event.Finished, r, WithLatency(time.Second), WithErr(err))
+
+		ev := <-observed
+		So(ev.Type, ShouldEqual, event.Started)
+		So(ev.Key, ShouldEqual, "foo")
+		So(ev.Tenant, ShouldEqual, "bar")
+		So(ev.Time.IsZero(), ShouldBeFalse)
+
+		ev = <-observed
+		So(ev.Type, ShouldEqual, event.Finished)
+		So(ev.Latency, ShouldEqual, time.Second)
+		So(ev.Err, ShouldEqual, err)
+	})
+
+	Convey("Slow observer doesn't block", t, func() {
+		unblock := make(chan struct{})
+		e := NewEmitter(event.ObserverFunc(func(ev event.Event) {
+			<-unblock
+		}), 1)
+		defer close(unblock)
+
+		start := time.Now()
+		for i := 0; i < 10; i++ {
+			e.Emit(event.Started, job.Request{})
+		}
+
+		So(time.Since(start), ShouldBeLessThan, 100*time.Millisecond)
+		So(e.Dropped(), ShouldBeBetweenOrEqual, 8, 9)
+	})
+
+	Convey("Panic of the observer is recovered", t, func() {
+		observed := make(chan event.Event, 1)
+		e := NewEmitter(event.ObserverFunc(func(ev event.Event) {
+			if ev.Type == event.Started {
+				panic("boom")
+			}
+			observed <- ev
+		}), 10)
+		defer e.Close()
+
+		e.Emit(event.Started, job.Request{})
+		e.Emit(event.Finished, job.Request{})
+
+		So((<-observed).Type, ShouldEqual, event.Finished)
+		So(e.Panics(), ShouldEqual, 1)
+	})
+
+	Convey("Closed emitter drops events", t, func() {
+		observed := make(chan event.Event, 10)
+		e := NewEmitter(event.ObserverFunc(func(ev event.Event) {
+			observed <- ev
+		}), 10)
+
+		e.Close()
+		e.Close()
+		e.Emit(event.Started, job.Request{})
+
+		So(e.Dropped(), ShouldEqual, 1)
+		So(observed, ShouldBeEmpty)
+	})
+
+	Convey("Nil emitter", t, func() {
+		var e *Emitter
+
+		So(func() { e.Emit(event.Started, job.Request{}) }, ShouldNotPanic)
+		So(func() { e.Close() }, ShouldNotPanic)
+		So(e.Dropped(), ShouldEqual, 0)
+		So(e.Panics(), ShouldEqual, 0)
+	})
+}
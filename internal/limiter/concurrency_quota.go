@@ -0,0 +1,100 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/chatex-com/rate-limiter/pkg/config"
+)
+
+// ConcurrencyQuota limits the number of simultaneously executing jobs.
+// A slot is held from the job start till the job completion.
+type ConcurrencyQuota struct {
+	cfg      config.Quota
+	active   uint
+	activeMu sync.RWMutex
+}
+
+func NewConcurrencyQuota(cfg config.Quota) (*ConcurrencyQuota, error) {
+	if err := validateCapacity(cfg); err != nil {
+		return nil, err
+	}
+
+	q := &ConcurrencyQuota{
+		cfg: cfg,
+	}
+
+	return q, nil
+}
+
+func (q *ConcurrencyQuota) Acquire(n uint) {
+	q.activeMu.Lock()
+	defer q.activeMu.Unlock()
+
+	q.active += n
+}
+
+func (q *ConcurrencyQuota) Release(n uint) {
+	q.activeMu.Lock()
+	defer q.activeMu.Unlock()
+
+	if q.active > n {
+		q.active -= n
+	} else {
+		q.active = 0
+	}
+}
+
+// taken checks if any slot is held by a running job
+func (q *ConcurrencyQuota) taken() bool {
+	q.activeMu.RLock()
+	defer q.activeMu.RUnlock()
+
+	return q.active > 0
+}
+
+func (q *ConcurrencyQuota) GetFreeSlot() (time.Duration, bool) {
+	return q.GetFreeSlots(1)
+}
+
+// GetFreeSlots checks if n slots are available. The wait duration is always zero,
+// because it's impossible to predict when a running job will be finished:
+// waiters are woken up by the release signal of the group (see QuotaGroup.Released).
+func (q *ConcurrencyQuota) GetFreeSlots(n uint) (time.Duration, bool) {
+	q.activeMu.RLock()
+	defer q.activeMu.RUnlock()
+
+	return 0, q.active+n <= q.cfg.CapacityAt(time.Now())
+}
+
+// releaseSignal wakes up all waiters of concurrency slots on every release
+type releaseSignal struct {
+	ch chan struct{}
+	mu sync.Mutex
+}
+
+func newReleaseSignal() *releaseSignal {
+	return &releaseSignal{
+		ch: make(chan struct{}),
+	}
+}
+
+// wait returns the channel which is closed on the next release
+func (s *releaseSignal) wait() <-chan struct{} {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.ch
+}
+
+func (s *releaseSignal) notify() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	close(s.ch)
+	s.ch = make(chan struct{})
+}
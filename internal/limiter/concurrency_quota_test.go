@@ -0,0 +1,65 @@
+package limiter
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/chatex-com/rate-limiter/pkg/config"
+)
+
+func TestNewConcurrencyQuota(t *testing.T) {
+	Convey("Error on rule.Capacity is zero", t, func() {
+		quota, err := NewConcurrencyQuota(*config.NewConcurrencyQuota(0))
+
+		So(quota, ShouldBeNil)
+		So(err, ShouldEqual, ErrZeroRuleCount)
+	})
+
+	Convey("Success creation", t, func() {
+		quota, err := NewConcurrencyQuota(*config.NewConcurrencyQuota(2))
+
+		So(err, ShouldBeNil)
+		So(quota.cfg.Capacity, ShouldEqual, 2)
+	})
+}
+
+func TestConcurrencyQuotaFreeSlot(t *testing.T) {
+	Convey("Acquire and release slots", t, func() {
+		quota, _ := NewConcurrencyQuota(*config.NewConcurrencyQuota(1))
+
+		wait, free := quota.GetFreeSlot()
+		So(free, ShouldBeTrue)
+		So(wait, ShouldBeZeroValue)
+
+		quota.Acquire(1)
+
+		wait, free = quota.GetFreeSlot()
+		So(free, ShouldBeFalse)
+		So(wait, ShouldBeZeroValue)
+
+		quota.Release(1)
+		quota.Release(1)
+
+		So(quota.active, ShouldEqual, 0)
+		_, free = quota.GetFreeSlot()
+		So(free, ShouldBeTrue)
+	})
+}
+
+func TestConcurrencyQuotaFreeSlots(t *testing.T) {
+	Convey("Weighted slots", t, func() {
+		quota, _ := NewConcurrencyQuota(*config.NewConcurrencyQuota(3))
+
+		quota.Acquire(2)
+
+		_, free := quota.GetFreeSlots(1)
+		So(free, ShouldBeTrue)
+
+		_, free = quota.GetFreeSlots(2)
+		So(free, ShouldBeFalse)
+
+		quota.Release(2)
+		So(quota.active, ShouldEqual, 0)
+	})
+}
@@ -2,6 +2,7 @@ package limiter
 
 import (
 	"errors"
+	"sort"
 	"sync"
 	"time"
 
@@ -11,8 +12,11 @@ import (
 var (
 	ErrZeroRuleCount    = errors.New("rule.Capacity must be a positive value")
 	ErrZeroRuleInterval = errors.New("rule.Interval must be a positive value")
+	ErrWrongSchedule    = errors.New("schedule.From and schedule.To must be within a day")
 )
 
+// Quota is a sliding window of slot times. Times are sorted and may
+// be in the future if slots were booked in advance.
 type Quota struct {
 	cfg     config.Quota
 	times   []time.Time
@@ -20,8 +24,8 @@ type Quota struct {
 }
 
 func NewQuota(cfg config.Quota) (*Quota, error) {
-	if cfg.Capacity == 0 {
-		return nil, ErrZeroRuleCount
+	if err := validateCapacity(cfg); err != nil {
+		return nil, err
 	}
 
 	if cfg.Interval <= 0 {
@@ -39,36 +43,213 @@ func (r *Quota) Add(t time.Time) {
 	r.timesMu.Lock()
 	defer r.timesMu.Unlock()
 
-	r.times = append(r.times, t)
+	i := sort.Search(len(r.times), func(i int) bool {
+		return r.times[i].After(t)
+	})
 
-	go func() {
-		<-time.After(r.cfg.Interval)
+	r.times = append(r.times, time.Time{})
+	copy(r.times[i+1:], r.times[i:])
+	r.times[i] = t
 
-		r.timesMu.Lock()
-		defer r.timesMu.Unlock()
+	go func() {
+		<-time.After(time.Until(t) + r.cfg.Interval)
 
-		r.times = r.times[1:]
+		r.Remove(t)
 	}()
 }
 
+// Remove deletes a single occurrence of the time from the quota.
+// It returns false if the time was already released.
+func (r *Quota) Remove(t time.Time) bool {
+	r.timesMu.Lock()
+	defer r.timesMu.Unlock()
+
+	i := sort.Search(len(r.times), func(i int) bool {
+		return !r.times[i].Before(t)
+	})
+
+	if i == len(r.times) || !r.times[i].Equal(t) {
+		return false
+	}
+
+	r.times = append(r.times[:i], r.times[i+1:]...)
+
+	return true
+}
+
 func (r *Quota) GetFreeSlot() (time.Duration, bool) {
-	if r.freeSlots() > 0 {
+	return r.GetFreeSlots(1)
+}
+
+// GetFreeSlots checks if n slots are available. Otherwise it returns the wait
+// duration till enough slots are released. The weight must not exceed the capacity.
+func (r *Quota) GetFreeSlots(n uint) (time.Duration, bool) {
+	r.timesMu.RLock()
+	defer r.timesMu.RUnlock()
+
+	now := time.Now()
+	if r.fits(now, n) {
 		return 0, true
 	}
 
+	// free slots can appear when a taken slot is released
+	// or when the capacity is increased by the schedule
+	change := r.cfg.NextChange(now)
+	for _, t := range r.times {
+		release := t.Add(r.cfg.Interval)
+		if !change.IsZero() && change.Before(release) && r.fits(change, n) {
+			return change.Sub(now), false
+		}
+
+		if release.After(now) && r.fits(release, n) {
+			return release.Sub(now), false
+		}
+	}
+
+	if !change.IsZero() && r.fits(change, n) {
+		return change.Sub(now), false
+	}
+
+	return r.cfg.Interval, false
+}
+
+// CanBook checks if n slots can be taken at the time
+func (r *Quota) CanBook(at time.Time, n uint) bool {
 	r.timesMu.RLock()
 	defer r.timesMu.RUnlock()
 
-	wait := r.cfg.Interval - time.Since(r.times[0])
+	return r.fits(at, n)
+}
+
+// fits checks if n slots taken at the time don't exceed the capacity
+// of every window which includes the time
+func (r *Quota) fits(at time.Time, n uint) bool {
+	if r.count(at)+n > r.cfg.CapacityAt(at) {
+		return false
+	}
+
+	// windows which end at later slots (booked in advance) include the time too
+	end := at.Add(r.cfg.Interval)
+	for i := sort.Search(len(r.times), func(i int) bool {
+		return r.times[i].After(at)
+	}); i < len(r.times) && r.times[i].Before(end); i++ {
+		if r.count(r.times[i])+n > r.cfg.CapacityAt(r.times[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// count returns the number of slots within the window (at - interval, at]
+func (r *Quota) count(at time.Time) uint {
+	from := at.Add(-r.cfg.Interval)
 
-	return wait, false
+	start := sort.Search(len(r.times), func(i int) bool {
+		return r.times[i].After(from)
+	})
+	end := sort.Search(len(r.times), func(i int) bool {
+		return r.times[i].After(at)
+	})
+
+	return uint(end - start)
 }
 
-func (r *Quota) freeSlots() int32 {
+// earliestStart returns the lower bound of the time when the last of n more slots
+// can be taken. Every slot is taken at least the interval later than the slot taken
+// capacity slots before it, so only slots which are active now are considered.
+// Slots booked in advance and schedules are ignored: the max capacity is used.
+func (r *Quota) earliestStart(n uint, now time.Time) time.Time {
+	if n == 0 {
+		return now
+	}
+
+	r.timesMu.RLock()
+	defer r.timesMu.RUnlock()
+
+	capacity := int(r.cfg.MaxCapacity())
+	from := sort.Search(len(r.times), func(i int) bool {
+		return r.times[i].After(now.Add(-r.cfg.Interval))
+	})
+	to := sort.Search(len(r.times), func(i int) bool {
+		return r.times[i].After(now)
+	})
+
+	rounds := (int(n) - 1) / capacity
+	start := now
+
+	// the active slot which must be released before the first round of new slots
+	if k := to - from + int(n) - 1 - (rounds+1)*capacity; k >= 0 {
+		if release := r.times[from+k].Add(r.cfg.Interval); release.After(now) {
+			start = release
+		}
+	}
+
+	return start.Add(time.Duration(rounds) * r.cfg.Interval)
+}
+
+// taken checks if any slot isn't released yet, including slots booked in advance
+func (r *Quota) taken() bool {
+	r.timesMu.RLock()
+	defer r.timesMu.RUnlock()
+
+	return len(r.times) > 0
+}
+
+// releaseTimes returns times when active slots will be released in ascending order
+func (r *Quota) releaseTimes() []time.Time {
+	r.timesMu.RLock()
+	defer r.timesMu.RUnlock()
+
+	times := make([]time.Time, len(r.times))
+	for i, t := range r.times {
+		times[i] = t.Add(r.cfg.Interval)
+	}
+
+	return times
+}
+
+// validateCapacity checks capacities of the quota and its schedules
+func validateCapacity(cfg config.Quota) error {
+	if cfg.Capacity == 0 {
+		return ErrZeroRuleCount
+	}
+
+	for _, s := range cfg.Schedules {
+		if s.Capacity == 0 {
+			return ErrZeroRuleCount
+		}
+
+		if s.From < 0 || s.From >= 24*time.Hour || s.To < 0 || s.To >= 24*time.Hour {
+			return ErrWrongSchedule
+		}
+	}
+
+	return nil
+}
+
+// Times returns times of slots taken till now. Slots booked in advance are skipped.
+func (r *Quota) Times() []time.Time {
 	r.timesMu.RLock()
 	defer r.timesMu.RUnlock()
 
-	active := len(r.times)
+	now := time.Now()
+	times := make([]time.Time, 0, len(r.times))
+	for _, t := range r.times {
+		if !t.After(now) {
+			times = append(times, t)
+		}
+	}
+
+	return times
+}
 
-	return int32(r.cfg.Capacity) - int32(active)
+// Restore adds taken slots which are not released yet
+func (r *Quota) Restore(times []time.Time) {
+	now := time.Now()
+	for _, t := range times {
+		if t.Add(r.cfg.Interval).After(now) {
+			r.Add(t)
+		}
+	}
 }
@@ -1,33 +1,248 @@
 package limiter
 
 import (
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/chatex-com/rate-limiter/pkg/config"
 )
 
+// pathSeparator joins path elements into the ID of the path group.
+// It can't be used in a path element in practice.
+const pathSeparator = "\x00"
+
+// purgeInterval is the interval of eviction of idle groups of keys and paths
+const purgeInterval = time.Minute
+
 type QuotaGroup struct {
-	quotas     []*Quota
-	quotasLock sync.RWMutex
-	lock       sync.Locker
+	quotas      []*Quota
+	concurrency []*ConcurrencyQuota
+	quotasLock  sync.RWMutex
+	lock        sync.Locker
+	// released is shared with groups of keys and paths
+	released *releaseSignal
+	// evicted is set under the lock when the idle group is removed from its parent
+	evicted bool
+
+	keyQuotas  []config.Quota
+	keys       map[string]*QuotaGroup
+	keysLock   sync.Mutex
+	keysPurged time.Time
+
+	levelQuotas [][]config.Quota
+	paths       map[string]*QuotaGroup
+	pathsLock   sync.Mutex
+	pathsPurged time.Time
 }
 
 func NewQuotaGroup(quotas []config.Quota) (*QuotaGroup, error) {
 	list, err := createList(quotas)
+	if err != nil {
+		return nil, err
+	}
 
+	concurrency, err := createConcurrencyList(quotas)
 	if err != nil {
 		return nil, err
 	}
 
 	group := &QuotaGroup{
-		quotas: list,
-		lock:   &sync.Mutex{},
+		quotas:      list,
+		concurrency: concurrency,
+		lock:        &sync.Mutex{},
+		released:    newReleaseSignal(),
 	}
 
 	return group, nil
 }
 
+// SetKeyQuotas sets quotas which are applied separately to every key.
+// A dedicated group is created for each key on the first reservation
+// and it's evicted when all its slots are released.
+func (g *QuotaGroup) SetKeyQuotas(quotas []config.Quota) error {
+	// validate configuration before the first key is requested
+	if _, err := NewQuotaGroup(quotas); err != nil {
+		return err
+	}
+
+	g.keysLock.Lock()
+	defer g.keysLock.Unlock()
+
+	g.keyQuotas = quotas
+	g.keys = make(map[string]*QuotaGroup)
+
+	return nil
+}
+
+// Key returns the group of quotas for the key and nil if key quotas are not configured
+func (g *QuotaGroup) Key(key string) *QuotaGroup {
+	g.keysLock.Lock()
+	defer g.keysLock.Unlock()
+
+	if len(g.keyQuotas) == 0 {
+		return nil
+	}
+
+	if now := time.Now(); now.Sub(g.keysPurged) > purgeInterval {
+		purgeGroups(g.keys)
+		g.keysPurged = now
+	}
+
+	group, ok := g.keys[key]
+	if !ok {
+		// configuration was validated in SetKeyQuotas
+		group, _ = NewQuotaGroup(g.keyQuotas)
+		group.released = g.released
+		g.keys[key] = group
+	}
+
+	return group
+}
+
+// SetLevelQuotas sets quotas of the levels of the hierarchy. Quotas of the level i
+// are applied separately to every path prefix of i+1 elements. A dedicated group
+// is created for each path prefix on the first reservation and it's evicted
+// when all its slots are released.
+func (g *QuotaGroup) SetLevelQuotas(levels [][]config.Quota) error {
+	for _, quotas := range levels {
+		// validate configuration before the first path is requested
+		if _, err := NewQuotaGroup(quotas); err != nil {
+			return err
+		}
+	}
+
+	g.pathsLock.Lock()
+	defer g.pathsLock.Unlock()
+
+	g.levelQuotas = levels
+	g.paths = make(map[string]*QuotaGroup)
+
+	return nil
+}
+
+// Path returns the group of quotas for the last element of the path
+// and nil if quotas of the level are not configured
+func (g *QuotaGroup) Path(path []string) *QuotaGroup {
+	g.pathsLock.Lock()
+	defer g.pathsLock.Unlock()
+
+	level := len(path) - 1
+	if level < 0 || level >= len(g.levelQuotas) || len(g.levelQuotas[level]) == 0 {
+		return nil
+	}
+
+	if now := time.Now(); now.Sub(g.pathsPurged) > purgeInterval {
+		purgeGroups(g.paths)
+		g.pathsPurged = now
+	}
+
+	id := strings.Join(path, pathSeparator)
+
+	group, ok := g.paths[id]
+	if !ok {
+		// configuration was validated in SetLevelQuotas
+		group, _ = NewQuotaGroup(g.levelQuotas[level])
+		group.released = g.released
+		g.paths[id] = group
+	}
+
+	return group
+}
+
+// Reservation is a slot taken in every quota of the groups.
+// Slots of concurrency quotas must be released when the job is completed,
+// slots of other quotas can be refunded if the job didn't reach the upstream.
+type Reservation struct {
+	slots    []slot
+	released int32
+	booked   bool
+}
+
+type slot struct {
+	group  *QuotaGroup
+	time   time.Time
+	weight uint
+}
+
+// Refund returns the reserved slot back to every time window quota
+func (r *Reservation) Refund() {
+	for _, s := range r.slots {
+		s.group.refund(s.time, s.weight)
+	}
+}
+
+// Release frees the slot of every concurrency quota. Subsequent calls do nothing.
+func (r *Reservation) Release() {
+	if !atomic.CompareAndSwapInt32(&r.released, 0, 1) {
+		return
+	}
+
+	for _, s := range r.slots {
+		s.group.release(s.weight)
+	}
+}
+
+// Booked checks if the slots were booked in advance (see BookPath)
+func (r *Reservation) Booked() bool {
+	return r.booked
+}
+
+// Move takes the slots at the time instead of the reserved time, e.g. when the job
+// is started later than the time of its booking. Slots of concurrency quotas are taken
+// as well, if they aren't held yet, and freed with Release. If the slots don't fit
+// at the time the reservation isn't changed and exhausted quotas are returned.
+func (r *Reservation) Move(at time.Time) []config.Quota {
+	groups := make([]*QuotaGroup, len(r.slots))
+	for i, s := range r.slots {
+		groups[i] = s.group
+	}
+
+	unlock := lockGroups(groups)
+	defer unlock()
+
+	r.Refund()
+
+	acquire := atomic.LoadInt32(&r.released) == 1
+	for _, s := range r.slots {
+		exhausted := s.group.checkBooking(at, s.weight)
+		if acquire {
+			exhausted = append(exhausted, s.group.checkConcurrency(s.weight)...)
+		}
+
+		if exhausted != nil {
+			for _, s := range r.slots {
+				s.group.book(s.time, s.weight)
+			}
+
+			return exhausted
+		}
+	}
+
+	for i, s := range r.slots {
+		s.group.book(at, s.weight)
+		if acquire {
+			s.group.acquire(s.weight)
+		}
+		r.slots[i].time = at
+	}
+
+	if acquire {
+		atomic.StoreInt32(&r.released, 0)
+	}
+
+	return nil
+}
+
+// Released returns the channel which is closed when a slot of any concurrency quota
+// of the group or of groups of its keys and paths is released. It must be taken
+// before the reservation attempt, so the release after the attempt isn't missed.
+func (g *QuotaGroup) Released() <-chan struct{} {
+	return g.released.wait()
+}
+
 // Make a reservation for new slot. It means that you will
 // immediately use it for execution query
 //
@@ -35,27 +250,316 @@ func NewQuotaGroup(quotas []config.Quota) (*QuotaGroup, error) {
 // 1st value - result of reservation. True = success, false = fail
 // 2nd value - wait duration for next attempt if reservation was failed and zero otherwise
 func (g *QuotaGroup) ReserveFreeSlot() (bool, time.Duration) {
+	r, wait := g.Reserve()
+
+	return r != nil, wait
+}
+
+// Reserve works the same way as ReserveFreeSlot but returns the reservation
+// which can be refunded later. The reservation is nil if it was failed.
+func (g *QuotaGroup) Reserve() (*Reservation, time.Duration) {
+	r, wait, _ := g.ReserveKey("", 1)
+
+	return r, wait
+}
+
+// ReserveKey makes a reservation of weight slots in the group and in the group of the key.
+// Either both reservations succeed or none of them is made.
+// If the reservation is failed it returns the wait duration and exhausted quotas.
+// The wait duration is zero if only concurrency quotas are exhausted (see Released).
+func (g *QuotaGroup) ReserveKey(key string, weight uint) (*Reservation, time.Duration, []config.Quota) {
+	return g.ReservePath(key, nil, weight)
+}
+
+// ReservePath works the same way as ReserveKey but also reserves slots in groups
+// of every level of the path. If any level is exhausted none of reservations is made.
+func (g *QuotaGroup) ReservePath(key string, path []string, weight uint) (*Reservation, time.Duration, []config.Quota) {
+	groups, unlock := g.lockPath(key, path)
+	defer unlock()
+
+	for _, group := range groups {
+		if wait, exhausted := group.checkSlot(weight); exhausted != nil {
+			return nil, wait, exhausted
+		}
+	}
+
+	r := &Reservation{}
+	for _, group := range groups {
+		r.slots = append(r.slots, group.reserveSlot(weight))
+	}
+
+	return r, 0, nil
+}
+
+// BookKey books weight slots at the future time in every time window quota of the group
+// and of the group of the key, so the slots are unavailable to other reservations.
+// Concurrency quotas are not booked: their slots are taken by Move at the start.
+// If the slots are already taken it returns nil and the exhausted quotas.
+// The booking is canceled with Refund.
+func (g *QuotaGroup) BookKey(at time.Time, key string, weight uint) (*Reservation, []config.Quota) {
+	return g.BookPath(at, key, nil, weight)
+}
+
+// BookPath works the same way as BookKey but also books slots in groups of every level of the path
+func (g *QuotaGroup) BookPath(at time.Time, key string, path []string, weight uint) (*Reservation, []config.Quota) {
+	groups, unlock := g.lockPath(key, path)
+	defer unlock()
+
+	for _, group := range groups {
+		if exhausted := group.checkBooking(at, weight); exhausted != nil {
+			return nil, exhausted
+		}
+	}
+
+	r := &Reservation{}
+	for _, group := range groups {
+		group.book(at, weight)
+		r.slots = append(r.slots, slot{group: group, time: at, weight: weight})
+	}
+
+	// slots of concurrency quotas are taken by Move
+	r.released = 1
+	r.booked = true
+
+	return r, nil
+}
+
+// GetFreeSlot checks if a slot is available in the group and in the group
+// of the key without reservation. It returns the wait duration otherwise.
+func (g *QuotaGroup) GetFreeSlot(key string) (time.Duration, bool) {
+	return g.GetFreeSlotPath(key, nil)
+}
+
+// GetFreeSlotPath works the same way as GetFreeSlot but also checks groups of every level of the path
+func (g *QuotaGroup) GetFreeSlotPath(key string, path []string) (time.Duration, bool) {
+	var wait time.Duration
+	isFree := true
+	for _, group := range g.groups(key, path) {
+		w, free := group.freeSlotWait()
+		if !free {
+			isFree = false
+		}
+
+		if w > wait {
+			wait = w
+		}
+	}
+
+	return wait, isFree
+}
+
+// Capacity returns the max weight which can be reserved for the key
+// at any time and zero if the weight is not limited
+func (g *QuotaGroup) Capacity(key string) uint {
+	return g.CapacityPath(key, nil)
+}
+
+// CapacityPath works the same way as Capacity but also considers groups of every level of the path
+func (g *QuotaGroup) CapacityPath(key string, path []string) uint {
+	var capacity uint
+	for _, group := range g.groups(key, path) {
+		for _, q := range group.quotas {
+			if c := q.cfg.MaxCapacity(); capacity == 0 || c < capacity {
+				capacity = c
+			}
+		}
+
+		for _, q := range group.concurrency {
+			if c := q.cfg.MaxCapacity(); capacity == 0 || c < capacity {
+				capacity = c
+			}
+		}
+	}
+
+	return capacity
+}
+
+// Estimate simulates reservations of the weights one by one and returns
+// the wait duration of the last one. Only time window quotas of the group
+// are considered: key quotas and concurrency quotas are ignored.
+func (g *QuotaGroup) Estimate(weights []uint) time.Duration {
+	now := time.Now()
+	start := now
+
+	releases := make([][]time.Time, len(g.quotas))
+	for i, q := range g.quotas {
+		releases[i] = q.releaseTimes()
+		sort.Slice(releases[i], func(a, b int) bool {
+			return releases[i][a].Before(releases[i][b])
+		})
+	}
+
+	for _, weight := range weights {
+		for i, q := range g.quotas {
+			// the number of the earliest slots which must be released
+			// before the weight fits into the capacity
+			release := len(releases[i]) + int(weight) - int(q.cfg.CapacityAt(start))
+			if release > len(releases[i]) {
+				release = len(releases[i])
+			}
+
+			if release > 0 && releases[i][release-1].After(start) {
+				start = releases[i][release-1]
+			}
+		}
+
+		for i, q := range g.quotas {
+			for n := uint(0); n < weight; n++ {
+				releases[i] = append(releases[i], start.Add(q.cfg.Interval))
+			}
+		}
+	}
+
+	return start.Sub(now)
+}
+
+// MinWait returns the lower bound of the wait duration till the weight slots are taken
+// in every time window quota of the group. Unlike Estimate it doesn't depend on the number
+// of slots. Key quotas and concurrency quotas are ignored.
+func (g *QuotaGroup) MinWait(weight uint) time.Duration {
+	g.quotasLock.RLock()
+	defer g.quotasLock.RUnlock()
+
+	now := time.Now()
+	start := now
+	for _, q := range g.quotas {
+		if s := q.earliestStart(weight, now); s.After(start) {
+			start = s
+		}
+	}
+
+	return start.Sub(now)
+}
+
+func (g *QuotaGroup) groups(key string, path []string) []*QuotaGroup {
+	groups := []*QuotaGroup{g}
+
+	if key != "" {
+		if group := g.Key(key); group != nil {
+			groups = append(groups, group)
+		}
+	}
+
+	for i := range path {
+		if group := g.Path(path[:i+1]); group != nil {
+			groups = append(groups, group)
+		}
+	}
+
+	return groups
+}
+
+func (g *QuotaGroup) freeSlotWait() (time.Duration, bool) {
 	g.lock.Lock()
 	defer g.lock.Unlock()
 
-	if len(g.quotas) == 0 {
-		return true, 0
+	var wait time.Duration
+	isFree := true
+	for _, q := range g.quotas {
+		if w, free := q.GetFreeSlot(); !free {
+			isFree = false
+			if w > wait {
+				wait = w
+			}
+		}
+	}
+
+	for _, q := range g.concurrency {
+		if _, free := q.GetFreeSlot(); !free {
+			isFree = false
+		}
+	}
+
+	return wait, isFree
+}
+
+// lockPath locks groups of the key and the path. Groups are taken again
+// if any of them was evicted before it was locked.
+func (g *QuotaGroup) lockPath(key string, path []string) ([]*QuotaGroup, func()) {
+	for {
+		groups := g.groups(key, path)
+		unlock := lockGroups(groups)
+
+		evicted := false
+		for _, group := range groups {
+			evicted = evicted || group.evicted
+		}
+
+		if !evicted {
+			return groups, unlock
+		}
+
+		unlock()
+	}
+}
+
+// purgeGroups evicts idle groups, the lock of the map must be held
+func purgeGroups(groups map[string]*QuotaGroup) {
+	for id, group := range groups {
+		group.lock.Lock()
+		if group.idle() {
+			group.evicted = true
+			delete(groups, id)
+		}
+		group.lock.Unlock()
+	}
+}
+
+// idle checks if no slot of the group is taken. The lock of the group must be held.
+func (g *QuotaGroup) idle() bool {
+	g.quotasLock.RLock()
+	defer g.quotasLock.RUnlock()
+
+	for _, q := range g.quotas {
+		if q.taken() {
+			return false
+		}
+	}
+
+	for _, q := range g.concurrency {
+		if q.taken() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// lockGroups locks the groups in the order of the hierarchy (the root, the key and levels
+// of the path), so reservations of several groups are atomic and can't deadlock
+func lockGroups(groups []*QuotaGroup) func() {
+	for _, group := range groups {
+		group.lock.Lock()
+	}
+
+	return func() {
+		for i := len(groups) - 1; i >= 0; i-- {
+			groups[i].lock.Unlock()
+		}
 	}
+}
 
-	var limited bool
-	waits := make([]time.Duration, len(g.quotas))
+// checkSlot returns the list of exhausted quotas and the wait duration if weight slots
+// can't be reserved now. The lock of the group must be held.
+func (g *QuotaGroup) checkSlot(weight uint) (time.Duration, []config.Quota) {
+	var exhausted []config.Quota
+	waits := make([]time.Duration, 0, len(g.quotas)+len(g.concurrency))
 	for _, q := range g.quotas {
-		wait, free := q.GetFreeSlot()
+		wait, free := q.GetFreeSlots(weight)
 
 		if !free {
-			limited = true
+			exhausted = append(exhausted, q.cfg)
 			waits = append(waits, wait)
 		}
 	}
 
-	if !limited {
-		g.reserve()
-		return true, 0
+	for _, q := range g.concurrency {
+		wait, free := q.GetFreeSlots(weight)
+
+		if !free {
+			exhausted = append(exhausted, q.cfg)
+			waits = append(waits, wait)
+		}
 	}
 
 	// find max duration from waits slice
@@ -66,28 +570,137 @@ func (g *QuotaGroup) ReserveFreeSlot() (bool, time.Duration) {
 		}
 	}
 
-	return false, wait
+	return wait, exhausted
+}
+
+// reserveSlot takes weight slots checked by checkSlot. The lock of the group must be held.
+func (g *QuotaGroup) reserveSlot(weight uint) slot {
+	if len(g.quotas) == 0 && len(g.concurrency) == 0 {
+		return slot{group: g}
+	}
+
+	return slot{group: g, time: g.reserve(weight), weight: weight}
+}
+
+// checkBooking returns the list of exhausted quotas if weight slots can't be booked
+// at the time. The lock of the group must be held.
+func (g *QuotaGroup) checkBooking(at time.Time, weight uint) []config.Quota {
+	var exhausted []config.Quota
+	for _, q := range g.quotas {
+		if !q.CanBook(at, weight) {
+			exhausted = append(exhausted, q.cfg)
+		}
+	}
+
+	return exhausted
+}
+
+// checkConcurrency returns the list of busy concurrency quotas if weight slots
+// can't be taken now. The lock of the group must be held.
+func (g *QuotaGroup) checkConcurrency(weight uint) []config.Quota {
+	var exhausted []config.Quota
+	for _, q := range g.concurrency {
+		if _, free := q.GetFreeSlots(weight); !free {
+			exhausted = append(exhausted, q.cfg)
+		}
+	}
+
+	return exhausted
+}
+
+func (g *QuotaGroup) book(at time.Time, weight uint) {
+	g.quotasLock.RLock()
+	defer g.quotasLock.RUnlock()
+
+	for _, q := range g.quotas {
+		for n := uint(0); n < weight; n++ {
+			q.Add(at)
+		}
+	}
 }
 
-func (g *QuotaGroup) reserve() {
+func (g *QuotaGroup) reserve(weight uint) time.Time {
 	g.quotasLock.RLock()
 	defer g.quotasLock.RUnlock()
 
 	now := time.Now()
 	for _, q := range g.quotas {
-		q.Add(now)
+		for n := uint(0); n < weight; n++ {
+			q.Add(now)
+		}
+	}
+
+	for _, q := range g.concurrency {
+		q.Acquire(weight)
+	}
+
+	return now
+}
+
+func (g *QuotaGroup) acquire(weight uint) {
+	g.quotasLock.RLock()
+	defer g.quotasLock.RUnlock()
+
+	for _, q := range g.concurrency {
+		q.Acquire(weight)
+	}
+}
+
+func (g *QuotaGroup) refund(t time.Time, weight uint) {
+	g.quotasLock.RLock()
+	defer g.quotasLock.RUnlock()
+
+	for _, q := range g.quotas {
+		for n := uint(0); n < weight; n++ {
+			q.Remove(t)
+		}
+	}
+}
+
+func (g *QuotaGroup) release(weight uint) {
+	g.quotasLock.RLock()
+	defer g.quotasLock.RUnlock()
+
+	for _, q := range g.concurrency {
+		q.Release(weight)
+	}
+
+	if len(g.concurrency) > 0 {
+		g.released.notify()
 	}
 }
 
 func createList(cfgQuotas []config.Quota) ([]*Quota, error) {
-	quotas := make([]*Quota, len(cfgQuotas))
+	quotas := make([]*Quota, 0, len(cfgQuotas))
+
+	for _, cfgQuota := range cfgQuotas {
+		if cfgQuota.Type != config.QuotaTypeWindow {
+			continue
+		}
 
-	for i, cfgQuota := range cfgQuotas {
 		quota, err := NewQuota(cfgQuota)
 		if err != nil {
 			return nil, err
 		}
-		quotas[i] = quota
+		quotas = append(quotas, quota)
+	}
+
+	return quotas, nil
+}
+
+func createConcurrencyList(cfgQuotas []config.Quota) ([]*ConcurrencyQuota, error) {
+	var quotas []*ConcurrencyQuota
+
+	for _, cfgQuota := range cfgQuotas {
+		if cfgQuota.Type != config.QuotaTypeConcurrency {
+			continue
+		}
+
+		quota, err := NewConcurrencyQuota(cfgQuota)
+		if err != nil {
+			return nil, err
+		}
+		quotas = append(quotas, quota)
 	}
 
 	return quotas, nil
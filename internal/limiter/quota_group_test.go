@@ -1,6 +1,7 @@
 package limiter
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
@@ -82,7 +83,7 @@ func TestReverse(t *testing.T) {
 		now := time.Now()
 		check := time.Since(now) + time.Millisecond
 		group, _ := NewQuotaGroup(quotas)
-		group.reserve()
+		group.reserve(1)
 
 		time.Sleep(time.Millisecond) // check that all goroutines were started
 
@@ -132,3 +133,489 @@ func TestReserveFreeSlot(t *testing.T) {
 		So(wait, ShouldAlmostEqual, time.Second, 2 * time.Millisecond)
 	})
 }
+
+func TestRefund(t *testing.T) {
+	Convey("Refund returns slot to every quota", t, func() {
+		group, _ := NewQuotaGroup([]config.Quota{
+			*config.NewQuota(1, time.Second),
+			*config.NewQuota(5, time.Minute),
+		})
+		reservation, wait := group.Reserve()
+
+		So(reservation, ShouldNotBeNil)
+		So(wait, ShouldEqual, 0)
+		So(group.quotas[0].times, ShouldHaveLength, 1)
+		So(group.quotas[1].times, ShouldHaveLength, 1)
+
+		reservation.Refund()
+
+		So(group.quotas[0].times, ShouldBeEmpty)
+		So(group.quotas[1].times, ShouldBeEmpty)
+
+		free, _ := group.ReserveFreeSlot()
+		So(free, ShouldBeTrue)
+	})
+
+	Convey("Refund with empty quotas", t, func() {
+		group, _ := NewQuotaGroup([]config.Quota{})
+		reservation, _ := group.Reserve()
+
+		So(reservation, ShouldNotBeNil)
+		So(reservation.Refund, ShouldNotPanic)
+	})
+}
+
+func TestReserveConcurrency(t *testing.T) {
+	Convey("Concurrency slot is held till release", t, func() {
+		group, err := NewQuotaGroup([]config.Quota{
+			*config.NewQuota(10, time.Second),
+			*config.NewConcurrencyQuota(1),
+		})
+		So(err, ShouldBeNil)
+		So(group.quotas, ShouldHaveLength, 1)
+		So(group.concurrency, ShouldHaveLength, 1)
+
+		reservation, _ := group.Reserve()
+		So(reservation, ShouldNotBeNil)
+
+		free, wait := group.ReserveFreeSlot()
+		So(free, ShouldBeFalse)
+		So(wait, ShouldBeZeroValue)
+
+		_, free = group.GetFreeSlot("")
+		So(free, ShouldBeFalse)
+
+		released := group.Released()
+		select {
+		case <-released:
+			So("the slot is released", ShouldBeEmpty)
+		default:
+		}
+
+		reservation.Release()
+		reservation.Release()
+
+		select {
+		case <-released:
+		default:
+			So("the release is not signaled", ShouldBeEmpty)
+		}
+
+		free, _ = group.ReserveFreeSlot()
+		So(free, ShouldBeTrue)
+	})
+
+	Convey("Release of the key slot is signaled", t, func() {
+		group, _ := NewQuotaGroup([]config.Quota{})
+		_ = group.SetKeyQuotas([]config.Quota{*config.NewConcurrencyQuota(1)})
+
+		reservation, _, _ := group.ReserveKey("foo", 1)
+		So(reservation, ShouldNotBeNil)
+
+		released := group.Released()
+		reservation.Release()
+
+		select {
+		case <-released:
+		default:
+			So("the release is not signaled", ShouldBeEmpty)
+		}
+	})
+}
+
+func TestReserveKey(t *testing.T) {
+	Convey("Wrong key quotas configuration", t, func() {
+		group, _ := NewQuotaGroup([]config.Quota{})
+		err := group.SetKeyQuotas([]config.Quota{*config.NewQuota(0, time.Second)})
+
+		So(err, ShouldEqual, ErrZeroRuleCount)
+	})
+
+	Convey("Key quotas are not configured", t, func() {
+		group, _ := NewQuotaGroup([]config.Quota{})
+
+		So(group.Key("foo"), ShouldBeNil)
+
+		reservation, _, _ := group.ReserveKey("foo", 1)
+		So(reservation, ShouldNotBeNil)
+	})
+
+	Convey("Quotas are applied separately to every key", t, func() {
+		group, _ := NewQuotaGroup([]config.Quota{
+			*config.NewQuota(3, time.Second),
+		})
+		_ = group.SetKeyQuotas([]config.Quota{
+			*config.NewQuota(1, time.Second),
+		})
+
+		r1, _, _ := group.ReserveKey("foo", 1)
+		So(r1, ShouldNotBeNil)
+		So(group.Key("foo"), ShouldEqual, group.Key("foo"))
+
+		r2, wait, exhausted := group.ReserveKey("foo", 1)
+		So(r2, ShouldBeNil)
+		So(wait, ShouldAlmostEqual, time.Second, 2*time.Millisecond)
+		So(exhausted, ShouldResemble, []config.Quota{*config.NewQuota(1, time.Second)})
+
+		// failed reservation for the key is rolled back in the parent group
+		So(group.quotas[0].times, ShouldHaveLength, 1)
+
+		r3, _, _ := group.ReserveKey("bar", 1)
+		So(r3, ShouldNotBeNil)
+		So(group.quotas[0].times, ShouldHaveLength, 2)
+	})
+}
+
+func TestPurgeKeys(t *testing.T) {
+	Convey("Idle groups of keys are evicted", t, func() {
+		group, _ := NewQuotaGroup([]config.Quota{})
+		_ = group.SetKeyQuotas([]config.Quota{
+			*config.NewQuota(1, time.Millisecond),
+		})
+
+		for i := 0; i < 1000; i++ {
+			r, _, _ := group.ReserveKey(fmt.Sprintf("key-%d", i), 1)
+			So(r, ShouldNotBeNil)
+		}
+		So(group.keys, ShouldHaveLength, 1000)
+
+		evicted := group.Key("key-0")
+		time.Sleep(10 * time.Millisecond)
+		group.keysPurged = time.Time{}
+
+		So(group.Key("foo"), ShouldNotBeNil)
+		So(group.keys, ShouldHaveLength, 1)
+		So(evicted.evicted, ShouldBeTrue)
+
+		// an evicted group is taken again on reservation
+		r, _, _ := group.ReserveKey("key-0", 1)
+		So(r, ShouldNotBeNil)
+		So(group.Key("key-0"), ShouldNotEqual, evicted)
+	})
+
+	Convey("Groups with taken slots are kept", t, func() {
+		group, _ := NewQuotaGroup([]config.Quota{})
+		_ = group.SetKeyQuotas([]config.Quota{
+			*config.NewQuota(1, time.Millisecond),
+			*config.NewConcurrencyQuota(1),
+		})
+
+		r, _, _ := group.ReserveKey("foo", 1)
+		So(r, ShouldNotBeNil)
+
+		time.Sleep(10 * time.Millisecond)
+		group.keysPurged = time.Time{}
+		group.Key("bar")
+		So(group.keys, ShouldContainKey, "foo")
+
+		r.Release()
+		time.Sleep(10 * time.Millisecond)
+		group.keysPurged = time.Time{}
+		group.Key("bar")
+		So(group.keys, ShouldNotContainKey, "foo")
+	})
+}
+
+func TestPurgePaths(t *testing.T) {
+	Convey("Idle groups of path prefixes are evicted", t, func() {
+		group, _ := NewQuotaGroup([]config.Quota{})
+		_ = group.SetLevelQuotas([][]config.Quota{
+			{*config.NewQuota(1, time.Millisecond)},
+			{*config.NewConcurrencyQuota(1)},
+		})
+
+		for i := 0; i < 1000; i++ {
+			r, _, _ := group.ReservePath("", []string{fmt.Sprintf("account-%d", i)}, 1)
+			So(r, ShouldNotBeNil)
+		}
+		So(group.paths, ShouldHaveLength, 1000)
+
+		r, _, _ := group.ReservePath("", []string{"account", "order"}, 1)
+		So(r, ShouldNotBeNil)
+
+		time.Sleep(10 * time.Millisecond)
+		group.pathsPurged = time.Time{}
+		group.Path([]string{"foo"})
+
+		// the group of the running job is kept
+		So(group.paths, ShouldHaveLength, 2)
+		So(group.paths, ShouldContainKey, "account"+pathSeparator+"order")
+
+		r.Release()
+		group.pathsPurged = time.Time{}
+		group.Path([]string{"foo"})
+		So(group.paths, ShouldHaveLength, 1)
+	})
+}
+
+func TestReserveWeight(t *testing.T) {
+	Convey("Weighted reservation and refund", t, func() {
+		group, _ := NewQuotaGroup([]config.Quota{
+			*config.NewQuota(5, time.Second),
+			*config.NewConcurrencyQuota(4),
+		})
+
+		r, _, _ := group.ReserveKey("", 3)
+		So(r, ShouldNotBeNil)
+		So(group.quotas[0].times, ShouldHaveLength, 3)
+		So(group.concurrency[0].active, ShouldEqual, 3)
+
+		r2, _, exhausted := group.ReserveKey("", 2)
+		So(r2, ShouldBeNil)
+		So(exhausted, ShouldResemble, []config.Quota{*config.NewConcurrencyQuota(4)})
+
+		r.Release()
+		r.Refund()
+		So(group.quotas[0].times, ShouldBeEmpty)
+		So(group.concurrency[0].active, ShouldEqual, 0)
+	})
+}
+
+func TestCapacity(t *testing.T) {
+	Convey("Min capacity of the group and the key", t, func() {
+		group, _ := NewQuotaGroup([]config.Quota{})
+		So(group.Capacity(""), ShouldEqual, 0)
+
+		group, _ = NewQuotaGroup([]config.Quota{
+			*config.NewQuota(10, time.Second),
+			*config.NewConcurrencyQuota(8),
+		})
+		_ = group.SetKeyQuotas([]config.Quota{
+			*config.NewQuota(5, time.Second),
+		})
+
+		So(group.Capacity(""), ShouldEqual, 8)
+		So(group.Capacity("foo"), ShouldEqual, 5)
+	})
+}
+
+func TestEstimate(t *testing.T) {
+	Convey("Empty group", t, func() {
+		group, _ := NewQuotaGroup([]config.Quota{})
+
+		So(group.Estimate([]uint{1, 10, 100}), ShouldEqual, 0)
+	})
+
+	Convey("Queued reservations", t, func() {
+		group, _ := NewQuotaGroup([]config.Quota{
+			*config.NewQuota(2, time.Second),
+		})
+		group.ReserveKey("", 1)
+
+		So(group.Estimate([]uint{1}), ShouldEqual, 0)
+		So(group.Estimate([]uint{2}), ShouldAlmostEqual, time.Second, 5*time.Millisecond)
+		// 1st is started now, 2nd after release of the reserved slot, 3rd after release of the 1st
+		So(group.Estimate([]uint{1, 1, 1}), ShouldAlmostEqual, time.Second, 5*time.Millisecond)
+		So(group.Estimate([]uint{1, 1, 1, 1}), ShouldAlmostEqual, 2*time.Second, 5*time.Millisecond)
+	})
+}
+
+func TestMinWait(t *testing.T) {
+	Convey("Empty group", t, func() {
+		group, _ := NewQuotaGroup([]config.Quota{})
+
+		So(group.MinWait(100), ShouldEqual, 0)
+	})
+
+	Convey("The wait matches the estimate of single slots", t, func() {
+		group, _ := NewQuotaGroup([]config.Quota{
+			*config.NewQuota(2, time.Second),
+		})
+		group.ReserveKey("", 1)
+
+		So(group.MinWait(0), ShouldEqual, 0)
+		So(group.MinWait(1), ShouldEqual, 0)
+		for n := 2; n <= 7; n++ {
+			weights := make([]uint, n)
+			for i := range weights {
+				weights[i] = 1
+			}
+
+			So(group.MinWait(uint(n)), ShouldAlmostEqual, group.Estimate(weights), 5*time.Millisecond)
+		}
+	})
+
+	Convey("The wait doesn't exceed the estimate of several quotas", t, func() {
+		group, _ := NewQuotaGroup([]config.Quota{
+			*config.NewQuota(2, time.Second),
+			*config.NewQuota(3, time.Minute),
+		})
+		group.ReserveKey("", 1)
+
+		So(group.MinWait(4), ShouldAlmostEqual, time.Minute, 5*time.Millisecond)
+		So(group.MinWait(4), ShouldBeLessThanOrEqualTo, group.Estimate([]uint{1, 1, 1, 1}))
+	})
+}
+
+func TestBookKey(t *testing.T) {
+	Convey("Booked slots are unavailable to other reservations", t, func() {
+		group, _ := NewQuotaGroup([]config.Quota{
+			*config.NewQuota(2, time.Second),
+			*config.NewConcurrencyQuota(1),
+		})
+		_ = group.SetKeyQuotas([]config.Quota{
+			*config.NewQuota(1, time.Second),
+		})
+
+		at := time.Now().Add(500 * time.Millisecond)
+		b, exhausted := group.BookKey(at, "foo", 1)
+		So(b, ShouldNotBeNil)
+		So(exhausted, ShouldBeNil)
+		So(group.concurrency[0].active, ShouldEqual, 0)
+
+		// the key quota is exhausted by the booking
+		b2, exhausted := group.BookKey(at, "foo", 1)
+		So(b2, ShouldBeNil)
+		So(exhausted, ShouldResemble, []config.Quota{*config.NewQuota(1, time.Second)})
+		So(group.quotas[0].times, ShouldHaveLength, 1)
+
+		r, wait, _ := group.ReserveKey("foo", 1)
+		So(r, ShouldBeNil)
+		So(wait, ShouldAlmostEqual, 1500*time.Millisecond, 5*time.Millisecond)
+
+		// cancellation of the booking
+		b.Refund()
+		b.Release()
+		So(group.quotas[0].times, ShouldBeEmpty)
+
+		r, _, _ = group.ReserveKey("foo", 1)
+		So(r, ShouldNotBeNil)
+	})
+
+	Convey("Booked slots are moved to the start of the job", t, func() {
+		group, _ := NewQuotaGroup([]config.Quota{
+			*config.NewQuota(2, time.Second),
+		})
+		_ = group.SetKeyQuotas([]config.Quota{
+			*config.NewQuota(1, time.Second),
+		})
+
+		now := time.Now()
+		b, _ := group.BookKey(now.Add(-500*time.Millisecond), "foo", 1)
+		So(b.Booked(), ShouldBeTrue)
+
+		So(b.Move(now), ShouldBeNil)
+		So(group.quotas[0].times, ShouldResemble, []time.Time{now})
+		So(group.Key("foo").quotas[0].times, ShouldResemble, []time.Time{now})
+
+		// the key slot is taken by another booking
+		other, _ := group.BookKey(now.Add(1500*time.Millisecond), "foo", 1)
+		So(other, ShouldNotBeNil)
+
+		exhausted := b.Move(now.Add(time.Second))
+		So(exhausted, ShouldResemble, []config.Quota{*config.NewQuota(1, time.Second)})
+		So(group.quotas[0].times, ShouldHaveLength, 2)
+		So(group.quotas[0].times[0], ShouldEqual, now)
+		So(group.Key("foo").quotas[0].times[0], ShouldEqual, now)
+
+		r, _ := group.Reserve()
+		So(r, ShouldNotBeNil)
+		So(r.Booked(), ShouldBeFalse)
+	})
+
+	Convey("Concurrency slots are taken when booked slots are moved", t, func() {
+		group, _ := NewQuotaGroup([]config.Quota{
+			*config.NewQuota(2, time.Second),
+			*config.NewConcurrencyQuota(1),
+		})
+
+		now := time.Now()
+		b, _ := group.BookKey(now, "", 1)
+		So(group.concurrency[0].active, ShouldEqual, 0)
+
+		r, _ := group.Reserve()
+		So(r, ShouldNotBeNil)
+
+		exhausted := b.Move(now)
+		So(exhausted, ShouldResemble, []config.Quota{*config.NewConcurrencyQuota(1)})
+		So(group.quotas[0].times, ShouldHaveLength, 2)
+
+		r.Release()
+		So(b.Move(now), ShouldBeNil)
+		So(group.concurrency[0].active, ShouldEqual, 1)
+
+		b.Release()
+		So(group.concurrency[0].active, ShouldEqual, 0)
+	})
+}
+
+func TestReservePath(t *testing.T) {
+	Convey("Wrong level quotas configuration", t, func() {
+		group, _ := NewQuotaGroup([]config.Quota{})
+		err := group.SetLevelQuotas([][]config.Quota{{}, {*config.NewQuota(0, time.Second)}})
+
+		So(err, ShouldEqual, ErrZeroRuleCount)
+	})
+
+	Convey("Every level of the path must have a free slot", t, func() {
+		group, _ := NewQuotaGroup([]config.Quota{
+			*config.NewQuota(10, time.Hour),
+		})
+		_ = group.SetLevelQuotas([][]config.Quota{
+			{*config.NewQuota(3, time.Hour)},
+			{},
+			{*config.NewQuota(1, time.Hour)},
+		})
+
+		So(group.Path(nil), ShouldBeNil)
+		So(group.Path([]string{"account", "orders"}), ShouldBeNil)
+		So(group.Path([]string{"account", "orders", "alice", "extra"}), ShouldBeNil)
+		So(group.CapacityPath("", []string{"account", "orders", "alice"}), ShouldEqual, 1)
+
+		r, _, _ := group.ReservePath("", []string{"account", "orders", "alice"}, 1)
+		So(r, ShouldNotBeNil)
+
+		// the customer level is exhausted, nothing is reserved
+		r2, _, exhausted := group.ReservePath("", []string{"account", "orders", "alice"}, 1)
+		So(r2, ShouldBeNil)
+		So(exhausted, ShouldResemble, []config.Quota{*config.NewQuota(1, time.Hour)})
+		So(group.quotas[0].times, ShouldHaveLength, 1)
+		So(group.Path([]string{"account"}).quotas[0].times, ShouldHaveLength, 1)
+
+		// the same customer of another endpoint is a different node
+		r2, _, _ = group.ReservePath("", []string{"account", "trades", "alice"}, 1)
+		So(r2, ShouldNotBeNil)
+
+		// the account level is exhausted
+		r3, _, _ := group.ReservePath("", []string{"account", "orders", "bob"}, 1)
+		So(r3, ShouldNotBeNil)
+		r4, _, exhausted := group.ReservePath("", []string{"account", "orders", "carol"}, 1)
+		So(r4, ShouldBeNil)
+		So(exhausted, ShouldResemble, []config.Quota{*config.NewQuota(3, time.Hour)})
+		So(group.Path([]string{"account", "orders", "carol"}).quotas[0].times, ShouldBeEmpty)
+
+		_, free := group.GetFreeSlotPath("", []string{"another"})
+		So(free, ShouldBeTrue)
+
+		r.Refund()
+		r4, _, _ = group.ReservePath("", []string{"account", "orders", "carol"}, 1)
+		So(r4, ShouldNotBeNil)
+	})
+
+	Convey("Slots of all groups are checked and reserved at once", t, func() {
+		group, _ := NewQuotaGroup([]config.Quota{
+			*config.NewQuota(2, time.Hour),
+		})
+		_ = group.SetLevelQuotas([][]config.Quota{
+			{*config.NewQuota(1, time.Hour)},
+		})
+
+		// the reservation waits for the lock of the path group
+		level := group.Path([]string{"foo"})
+		level.lock.Lock()
+
+		reserved := make(chan *Reservation)
+		go func() {
+			r, _, _ := group.ReservePath("", []string{"foo"}, 1)
+			reserved <- r
+		}()
+
+		time.Sleep(10 * time.Millisecond)
+		So(group.quotas[0].times, ShouldBeEmpty)
+
+		level.lock.Unlock()
+		So(<-reserved, ShouldNotBeNil)
+		So(group.quotas[0].times, ShouldHaveLength, 1)
+		So(level.quotas[0].times, ShouldHaveLength, 1)
+	})
+}
@@ -50,28 +50,52 @@ func TestAddTime(t *testing.T) {
 	})
 }
 
+func TestRemoveTime(t *testing.T) {
+	Convey("Remove time", t, func() {
+		rule, _ := NewQuota(*config.NewQuota(2, time.Second))
+		t1 := time.Now()
+		t2 := t1.Add(time.Millisecond)
+		rule.Add(t1)
+		rule.Add(t2)
+
+		So(rule.Remove(t1), ShouldBeTrue)
+		So(rule.times, ShouldHaveLength, 1)
+		So(rule.times[0], ShouldEqual, t2)
+
+		So(rule.Remove(t1), ShouldBeFalse)
+		So(rule.times, ShouldHaveLength, 1)
+	})
+}
+
 func TestFreeSlots(t *testing.T) {
 	Convey("default", t, func() {
 		quota, _ := NewQuota(*config.NewQuota(2, 10 * time.Millisecond))
 
-		So(quota.freeSlots(), ShouldEqual, 2)
+		_, free := quota.GetFreeSlots(2)
+		So(free, ShouldBeTrue)
 
 		quota.Add(time.Now())
 
-		So(quota.freeSlots(), ShouldEqual, 1)
+		_, free = quota.GetFreeSlots(1)
+		So(free, ShouldBeTrue)
+		_, free = quota.GetFreeSlots(2)
+		So(free, ShouldBeFalse)
 
 		time.Sleep(20 * time.Millisecond)
 
-		So(quota.freeSlots(), ShouldEqual, 2)
+		_, free = quota.GetFreeSlots(2)
+		So(free, ShouldBeTrue)
 
 		quota.Add(time.Now())
 		quota.Add(time.Now())
 
-		So(quota.freeSlots(), ShouldEqual, 0)
+		_, free = quota.GetFreeSlots(1)
+		So(free, ShouldBeFalse)
 
 		time.Sleep(20 * time.Millisecond)
 
-		So(quota.freeSlots(), ShouldEqual, 2)
+		_, free = quota.GetFreeSlots(2)
+		So(free, ShouldBeTrue)
 	})
 }
 
@@ -112,3 +136,88 @@ func TestGetFreeSlot(t *testing.T) {
 		So(wait, ShouldBeZeroValue)
 	})
 }
+
+func TestGetFreeSlots(t *testing.T) {
+	Convey("Weighted slots", t, func() {
+		rule, _ := NewQuota(*config.NewQuota(3, time.Second))
+
+		t1 := time.Now()
+		rule.Add(t1)
+		rule.Add(t1.Add(100 * time.Millisecond))
+
+		wait, free := rule.GetFreeSlots(1)
+		So(free, ShouldBeTrue)
+		So(wait, ShouldBeZeroValue)
+
+		// the oldest slot must be released
+		wait, free = rule.GetFreeSlots(2)
+		So(free, ShouldBeFalse)
+		So(wait, ShouldAlmostEqual, time.Second, 5*time.Millisecond)
+
+		// both slots must be released
+		wait, free = rule.GetFreeSlots(3)
+		So(free, ShouldBeFalse)
+		So(wait, ShouldAlmostEqual, 1100*time.Millisecond, 5*time.Millisecond)
+	})
+}
+
+func TestBookedSlots(t *testing.T) {
+	Convey("Slots booked in advance", t, func() {
+		rule, _ := NewQuota(*config.NewQuota(2, time.Second))
+
+		at := time.Now().Add(time.Hour)
+		So(rule.CanBook(at, 2), ShouldBeTrue)
+		rule.Add(at)
+		rule.Add(at)
+
+		// windows which include the booked time are exhausted
+		So(rule.CanBook(at, 1), ShouldBeFalse)
+		So(rule.CanBook(at.Add(-500*time.Millisecond), 1), ShouldBeFalse)
+		So(rule.CanBook(at.Add(500*time.Millisecond), 1), ShouldBeFalse)
+		So(rule.CanBook(at.Add(-time.Second), 1), ShouldBeTrue)
+		So(rule.CanBook(at.Add(time.Second), 1), ShouldBeTrue)
+
+		// slots are available till the booked time
+		wait, free := rule.GetFreeSlots(2)
+		So(free, ShouldBeTrue)
+		So(wait, ShouldBeZeroValue)
+
+		So(rule.Remove(at), ShouldBeTrue)
+		So(rule.CanBook(at, 1), ShouldBeTrue)
+	})
+}
+
+func TestScheduledCapacity(t *testing.T) {
+	Convey("Wrong schedule", t, func() {
+		_, err := NewQuota(*config.NewQuota(1, time.Second).AddSchedule(config.NewSchedule(0, 0, time.Hour)))
+		So(err, ShouldEqual, ErrZeroRuleCount)
+
+		_, err = NewQuota(*config.NewQuota(1, time.Second).AddSchedule(config.NewSchedule(1, 0, 24*time.Hour)))
+		So(err, ShouldEqual, ErrWrongSchedule)
+	})
+
+	Convey("Usage history is preserved when the capacity is switched", t, func() {
+		now := time.Now().UTC()
+		midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		offset := now.Sub(midnight)
+
+		// the capacity is increased in 100ms
+		from := offset + 100*time.Millisecond
+		if from+time.Hour >= 24*time.Hour {
+			// too close to the midnight
+			return
+		}
+		cfg := config.NewQuota(1, time.Hour).AddSchedule(config.NewSchedule(3, from, from+time.Hour))
+		rule, _ := NewQuota(*cfg)
+
+		rule.Add(now)
+		wait, free := rule.GetFreeSlots(2)
+		So(free, ShouldBeFalse)
+		So(wait, ShouldAlmostEqual, 100*time.Millisecond, 5*time.Millisecond)
+
+		// the slot taken before the switch is counted
+		wait, free = rule.GetFreeSlots(3)
+		So(free, ShouldBeFalse)
+		So(wait, ShouldAlmostEqual, time.Hour, 5*time.Millisecond)
+	})
+}
@@ -0,0 +1,70 @@
+package limiter
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Shadow evaluates requests against quotas which are not enforced.
+// It records requests which would be delayed or expired by the quotas.
+type Shadow struct {
+	group    *QuotaGroup
+	delayed  int64
+	expired  int64
+	delay    int64
+	accepted int64
+}
+
+// ShadowStat is a snapshot of the shadow counters
+type ShadowStat struct {
+	// Accepted is the number of requests which would get a slot immediately
+	Accepted int64
+	// Delayed is the number of requests which would wait for a slot
+	Delayed int64
+	// Expired is the number of requests which would be expired on waiting for a slot
+	Expired int64
+	// Delay is the total duration of waits of delayed requests
+	Delay time.Duration
+}
+
+func NewShadow(group *QuotaGroup) *Shadow {
+	return &Shadow{
+		group: group,
+	}
+}
+
+// Evaluate takes a slot of shadow quotas as if the request was executed when the slot
+// became available. It returns the reservation to release when the job is completed
+// or nil if the request would be expired.
+func (s *Shadow) Evaluate(key string, path []string, weight uint, deadline time.Time) *Reservation {
+	r, wait, _ := s.group.ReservePath(key, path, weight)
+	if r != nil {
+		atomic.AddInt64(&s.accepted, 1)
+
+		return r
+	}
+
+	start := time.Now().Add(wait)
+	if !deadline.IsZero() && start.After(deadline) {
+		atomic.AddInt64(&s.expired, 1)
+
+		return nil
+	}
+
+	atomic.AddInt64(&s.delayed, 1)
+	atomic.AddInt64(&s.delay, int64(wait))
+
+	// the delayed request would take the slot later
+	r, _ = s.group.BookPath(start, key, path, weight)
+
+	return r
+}
+
+func (s *Shadow) Stat() ShadowStat {
+	return ShadowStat{
+		Accepted: atomic.LoadInt64(&s.accepted),
+		Delayed:  atomic.LoadInt64(&s.delayed),
+		Expired:  atomic.LoadInt64(&s.expired),
+		Delay:    time.Duration(atomic.LoadInt64(&s.delay)),
+	}
+}
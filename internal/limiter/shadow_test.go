@@ -0,0 +1,37 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/chatex-com/rate-limiter/pkg/config"
+)
+
+func TestShadow(t *testing.T) {
+	Convey("Would-be delays and expirations are recorded", t, func() {
+		group, _ := NewQuotaGroup([]config.Quota{
+			*config.NewQuota(1, time.Second),
+		})
+		shadow := NewShadow(group)
+
+		r := shadow.Evaluate("", nil, 1, time.Time{})
+		So(r, ShouldNotBeNil)
+
+		// the request would be started in a second
+		r = shadow.Evaluate("", nil, 1, time.Time{})
+		So(r, ShouldNotBeNil)
+		So(group.quotas[0].times, ShouldHaveLength, 2)
+
+		// the request would wait for the slot booked by the delayed one
+		r = shadow.Evaluate("", nil, 1, time.Now().Add(time.Second))
+		So(r, ShouldBeNil)
+
+		stat := shadow.Stat()
+		So(stat.Accepted, ShouldEqual, 1)
+		So(stat.Delayed, ShouldEqual, 1)
+		So(stat.Expired, ShouldEqual, 1)
+		So(stat.Delay, ShouldAlmostEqual, time.Second, 5*time.Millisecond)
+	})
+}
@@ -0,0 +1,107 @@
+package limiter
+
+import (
+	"strings"
+	"time"
+)
+
+// State is usage of time window quotas of the group and its key and path groups
+type State struct {
+	Quotas []QuotaState            `json:"quotas,omitempty"`
+	Keys   map[string][]QuotaState `json:"keys,omitempty"`
+	Paths  map[string][]QuotaState `json:"paths,omitempty"`
+}
+
+// QuotaState is times of slots taken in the quota with the interval
+type QuotaState struct {
+	Interval time.Duration `json:"interval"`
+	Times    []time.Time   `json:"times"`
+}
+
+// Snapshot returns usage of time window quotas. Concurrency quotas
+// and slots booked in advance are not included.
+func (g *QuotaGroup) Snapshot() State {
+	state := State{
+		Quotas: g.snapshot(),
+		Keys:   make(map[string][]QuotaState),
+		Paths:  make(map[string][]QuotaState),
+	}
+
+	g.keysLock.Lock()
+	for key, group := range g.keys {
+		state.Keys[key] = group.snapshot()
+	}
+	g.keysLock.Unlock()
+
+	g.pathsLock.Lock()
+	for id, group := range g.paths {
+		state.Paths[id] = group.snapshot()
+	}
+	g.pathsLock.Unlock()
+
+	return state
+}
+
+// Restore adds taken slots of the state to quotas with the same interval.
+// Quotas of keys and paths are restored if they are configured.
+func (g *QuotaGroup) Restore(state State) {
+	g.restore(state.Quotas)
+
+	for key, quotas := range state.Keys {
+		key := key
+		restoreGroup(func() *QuotaGroup { return g.Key(key) }, quotas)
+	}
+
+	for id, quotas := range state.Paths {
+		path := strings.Split(id, pathSeparator)
+		restoreGroup(func() *QuotaGroup { return g.Path(path) }, quotas)
+	}
+}
+
+// restoreGroup restores quotas of a group of a key or a path.
+// The group is taken again if it was evicted before it was locked.
+func restoreGroup(get func() *QuotaGroup, quotas []QuotaState) {
+	for {
+		group := get()
+		if group == nil {
+			return
+		}
+
+		group.lock.Lock()
+		if !group.evicted {
+			group.restore(quotas)
+			group.lock.Unlock()
+			return
+		}
+		group.lock.Unlock()
+	}
+}
+
+func (g *QuotaGroup) snapshot() []QuotaState {
+	g.quotasLock.RLock()
+	defer g.quotasLock.RUnlock()
+
+	quotas := make([]QuotaState, 0, len(g.quotas))
+	for _, q := range g.quotas {
+		quotas = append(quotas, QuotaState{
+			Interval: q.cfg.Interval,
+			Times:    q.Times(),
+		})
+	}
+
+	return quotas
+}
+
+func (g *QuotaGroup) restore(quotas []QuotaState) {
+	g.quotasLock.RLock()
+	defer g.quotasLock.RUnlock()
+
+	for _, q := range g.quotas {
+		for _, s := range quotas {
+			if s.Interval == q.cfg.Interval {
+				q.Restore(s.Times)
+				break
+			}
+		}
+	}
+}
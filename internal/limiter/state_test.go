@@ -0,0 +1,58 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/chatex-com/rate-limiter/pkg/config"
+)
+
+func TestSnapshot(t *testing.T) {
+	Convey("Usage of quotas is restored in a new group", t, func() {
+		quotas := []config.Quota{
+			*config.NewQuota(2, time.Hour),
+			*config.NewQuota(10, time.Minute),
+			*config.NewConcurrencyQuota(5),
+		}
+		keyQuotas := []config.Quota{*config.NewQuota(1, time.Hour)}
+		levelQuotas := [][]config.Quota{nil, {*config.NewQuota(1, time.Hour)}}
+
+		group, _ := NewQuotaGroup(quotas)
+		_ = group.SetKeyQuotas(keyQuotas)
+		_ = group.SetLevelQuotas(levelQuotas)
+
+		group.ReservePath("foo", []string{"account", "orders"}, 1)
+		group.BookKey(time.Now().Add(time.Hour), "", 1)
+
+		state := group.Snapshot()
+		So(state.Quotas, ShouldHaveLength, 2)
+		So(state.Quotas[0].Times, ShouldHaveLength, 1)
+		So(state.Keys["foo"][0].Times, ShouldHaveLength, 1)
+		So(state.Paths, ShouldHaveLength, 1)
+
+		// the interval of the second quota was changed
+		restored, _ := NewQuotaGroup([]config.Quota{
+			*config.NewQuota(1, time.Hour),
+			*config.NewQuota(10, time.Second),
+		})
+		_ = restored.SetKeyQuotas(keyQuotas)
+		_ = restored.SetLevelQuotas(levelQuotas)
+		restored.Restore(state)
+
+		So(restored.quotas[0].times, ShouldHaveLength, 1)
+		So(restored.quotas[1].times, ShouldBeEmpty)
+
+		_, free := restored.GetFreeSlotPath("foo", nil)
+		So(free, ShouldBeFalse)
+		So(restored.Path([]string{"account", "orders"}).quotas[0].times, ShouldHaveLength, 1)
+	})
+
+	Convey("Released slots are not restored", t, func() {
+		rule, _ := NewQuota(*config.NewQuota(2, time.Second))
+		rule.Restore([]time.Time{time.Now().Add(-time.Hour), time.Now()})
+
+		So(rule.times, ShouldHaveLength, 1)
+	})
+}
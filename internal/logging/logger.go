@@ -0,0 +1,111 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Logger writes structured logs of the limiter. Records of high-frequency events
+// are sampled: at most burst records per message are written within the interval.
+// Methods of a nil logger do nothing.
+type Logger struct {
+	logger   *slog.Logger
+	burst    int
+	interval time.Duration
+	samples  map[string]*sample
+	mu       sync.Mutex
+}
+
+type sample struct {
+	start      time.Time
+	written    int
+	suppressed int
+}
+
+// New creates the logger. Sampling is disabled if burst is zero.
+func New(l *slog.Logger, burst int, interval time.Duration) *Logger {
+	return &Logger{
+		logger:   l.With(slog.String("component", "rate_limiter")),
+		burst:    burst,
+		interval: interval,
+		samples:  make(map[string]*sample),
+	}
+}
+
+func (l *Logger) Debug(msg string, args ...interface{}) {
+	l.log(slog.LevelDebug, msg, args)
+}
+
+func (l *Logger) Info(msg string, args ...interface{}) {
+	l.log(slog.LevelInfo, msg, args)
+}
+
+func (l *Logger) Warn(msg string, args ...interface{}) {
+	l.log(slog.LevelWarn, msg, args)
+}
+
+func (l *Logger) Error(msg string, args ...interface{}) {
+	l.log(slog.LevelError, msg, args)
+}
+
+// Sampled writes the record if the limit of records with the message isn't reached.
+// The number of suppressed records is reported with the next written one.
+func (l *Logger) Sampled(level slog.Level, msg string, args ...interface{}) {
+	if l == nil || !l.logger.Enabled(context.Background(), level) {
+		return
+	}
+
+	if l.burst > 0 {
+		suppressed, ok := l.take(msg)
+		if !ok {
+			return
+		}
+
+		if suppressed > 0 {
+			args = append(args, slog.Int("suppressed", suppressed))
+		}
+	}
+
+	l.logger.Log(context.Background(), level, msg, args...)
+}
+
+func (l *Logger) log(level slog.Level, msg string, args []interface{}) {
+	if l == nil {
+		return
+	}
+
+	l.logger.Log(context.Background(), level, msg, args...)
+}
+
+// take returns false if the record must be suppressed
+func (l *Logger) take(msg string) (int, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	s, ok := l.samples[msg]
+	if !ok || now.Sub(s.start) >= l.interval {
+		var suppressed int
+		if ok {
+			suppressed = s.suppressed
+		}
+
+		l.samples[msg] = &sample{start: now, written: 1}
+
+		return suppressed, true
+	}
+
+	if s.written >= l.burst {
+		s.suppressed++
+
+		return 0, false
+	}
+
+	s.written++
+	suppressed := s.suppressed
+	s.suppressed = 0
+
+	return suppressed, true
+}
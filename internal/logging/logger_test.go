@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newTestLogger(burst int, interval time.Duration) (*Logger, *bytes.Buffer) {
+	buf := &bytes.Buffer{}
+	l := New(slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})), burst, interval)
+
+	return l, buf
+}
+
+func TestLogger(t *testing.T) {
+	Convey("Leveled records", t, func() {
+		l, buf := newTestLogger(0, 0)
+		l.Debug("foo", slog.String("key", "bar"))
+		l.Warn("baz")
+
+		So(buf.String(), ShouldContainSubstring, `level=DEBUG msg=foo component=rate_limiter key=bar`)
+		So(buf.String(), ShouldContainSubstring, `level=WARN msg=baz`)
+	})
+
+	Convey("Sampled records", t, func() {
+		l, buf := newTestLogger(2, 50*time.Millisecond)
+		for i := 0; i < 5; i++ {
+			l.Sampled(slog.LevelInfo, "foo")
+		}
+		l.Sampled(slog.LevelInfo, "bar")
+		So(strings.Count(buf.String(), "msg=foo"), ShouldEqual, 2)
+		So(strings.Count(buf.String(), "msg=bar"), ShouldEqual, 1)
+
+		time.Sleep(60 * time.Millisecond)
+		buf.Reset()
+		l.Sampled(slog.LevelInfo, "foo")
+		So(buf.String(), ShouldContainSubstring, "suppressed=3")
+	})
+
+	Convey("Sampling is disabled", t, func() {
+		l, buf := newTestLogger(0, time.Second)
+		for i := 0; i < 5; i++ {
+			l.Sampled(slog.LevelInfo, "foo")
+		}
+
+		So(strings.Count(buf.String(), "msg=foo"), ShouldEqual, 5)
+	})
+
+	Convey("Nil logger", t, func() {
+		var l *Logger
+
+		So(func() {
+			l.Info("foo")
+			l.Sampled(slog.LevelWarn, "foo")
+		}, ShouldNotPanic)
+	})
+}
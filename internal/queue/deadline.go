@@ -0,0 +1,355 @@
+package queue
+
+import (
+	"container/list"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+// DeadlineQueue dispatches requests in earliest deadline first order.
+// Requests without deadline are dispatched after others in FIFO order.
+// Requests pushed to the front are dispatched before all others.
+type DeadlineQueue struct {
+	// items are queued requests in the dispatching order
+	items *node
+	// submitted are queued requests in the submission order
+	submitted *list.List
+	byCh      map[<-chan job.Response]*item
+	// seq is the submission order of requests, front is decreased for requests pushed to the front
+	seq   int64
+	front int64
+	// watches are deadlines of dispatched requests by the sequence number of the latest request
+	// submitted before them, which was still queued at the moment of their dispatching
+	watches map[int64][]time.Time
+	saved   int64
+	mu      sync.Mutex
+	notify  chan struct{}
+}
+
+type item struct {
+	request job.Request
+	seq     int64
+	elem    *list.Element
+}
+
+func NewDeadlineQueue() *DeadlineQueue {
+	return &DeadlineQueue{
+		submitted: list.New(),
+		byCh:      make(map[<-chan job.Response]*item),
+		watches:   make(map[int64][]time.Time),
+		notify:    make(chan struct{}, 1),
+	}
+}
+
+func (q *DeadlineQueue) Push(r job.Request) {
+	q.mu.Lock()
+	q.seq++
+	q.push(r, q.seq)
+	q.mu.Unlock()
+
+	q.signal()
+}
+
+// PushFront puts the request ahead of all queued requests regardless of deadlines
+func (q *DeadlineQueue) PushFront(r job.Request) {
+	q.mu.Lock()
+	q.front--
+	q.push(r, q.front)
+	q.mu.Unlock()
+
+	q.signal()
+}
+
+func (q *DeadlineQueue) Wait(stop <-chan struct{}) bool {
+	return wait(q, q.notify, stop)
+}
+
+func (q *DeadlineQueue) Pop() (job.Request, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.items == nil {
+		return job.Request{}, false
+	}
+
+	it := q.items.first()
+	q.items = q.items.remove(it)
+	q.watch(it)
+	q.leave(it)
+
+	return it.request, true
+}
+
+func (q *DeadlineQueue) Remove(ch <-chan job.Response) (int, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	it, ok := q.byCh[ch]
+	if !ok {
+		return 0, false
+	}
+
+	pos := q.position(it)
+	q.items = q.items.remove(it)
+	q.leave(it)
+
+	return pos, true
+}
+
+func (q *DeadlineQueue) Position(ch <-chan job.Response) (int, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	it, ok := q.byCh[ch]
+	if !ok {
+		return 0, false
+	}
+
+	return q.position(it), true
+}
+
+func (q *DeadlineQueue) Weights() []uint {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	weights := make([]uint, 0, q.items.len())
+	q.items.walk(func(it *item) {
+		weights = append(weights, it.request.Slots())
+	})
+
+	return weights
+}
+
+// Ahead returns zero: the request can be dispatched before any queued request
+// depending on its deadline
+func (q *DeadlineQueue) Ahead(job.Request) uint {
+	return 0
+}
+
+func (q *DeadlineQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.items.len()
+}
+
+// Saved estimates the number of requests which would have been expired in FIFO order.
+// A request is counted if it was dispatched ahead of a request submitted earlier
+// and its deadline passed before the earlier request left the queue.
+func (q *DeadlineQueue) Saved() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.saved
+}
+
+func (q *DeadlineQueue) push(r job.Request, seq int64) {
+	it := &item{request: r, seq: seq}
+	if seq < 0 {
+		it.elem = q.submitted.PushFront(it)
+	} else {
+		it.elem = q.submitted.PushBack(it)
+	}
+
+	q.items = q.items.insert(&node{item: it, priority: rand.Uint32(), size: 1})
+	q.byCh[r.Ch] = it
+}
+
+// leave checks deadlines of requests dispatched ahead of the request which left the queue
+func (q *DeadlineQueue) leave(it *item) {
+	delete(q.byCh, it.request.Ch)
+	q.submitted.Remove(it.elem)
+
+	now := time.Now()
+	for _, deadline := range q.watches[it.seq] {
+		if now.After(deadline) {
+			q.saved++
+		}
+	}
+
+	delete(q.watches, it.seq)
+}
+
+// watch remembers the deadline of the dispatched request till the latest
+// request submitted before it leaves the queue. The request must be still
+// in the submission order.
+func (q *DeadlineQueue) watch(it *item) {
+	if it.request.ExpiredAt.IsZero() {
+		return
+	}
+
+	if prev := it.elem.Prev(); prev != nil {
+		latest := prev.Value.(*item)
+		q.watches[latest.seq] = append(q.watches[latest.seq], it.request.ExpiredAt)
+	}
+}
+
+func (q *DeadlineQueue) position(it *item) int {
+	return q.items.rank(it) + 1
+}
+
+func (q *DeadlineQueue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// before checks if the item must be dispatched before the other one
+func (it *item) before(other *item) bool {
+	// items pushed to the front have negative sequence numbers
+	if it.seq < 0 || other.seq < 0 {
+		return it.seq < other.seq
+	}
+
+	a, b := it.request.ExpiredAt, other.request.ExpiredAt
+	switch {
+	case a.Equal(b):
+		return it.seq < other.seq
+	case a.IsZero():
+		return false
+	case b.IsZero():
+		return true
+	default:
+		return a.Before(b)
+	}
+}
+
+// node is a node of the treap of queued items ordered by item.before.
+// Every node keeps the size of its subtree to find positions of items.
+type node struct {
+	item        *item
+	priority    uint32
+	size        int
+	left, right *node
+}
+
+func (n *node) len() int {
+	if n == nil {
+		return 0
+	}
+
+	return n.size
+}
+
+func (n *node) update() *node {
+	n.size = n.left.len() + n.right.len() + 1
+
+	return n
+}
+
+// insert adds the node to the tree and returns the new root
+func (n *node) insert(other *node) *node {
+	if n == nil {
+		return other
+	}
+
+	if other.priority > n.priority {
+		other.left, other.right = n.split(other.item)
+
+		return other.update()
+	}
+
+	if other.item.before(n.item) {
+		n.left = n.left.insert(other)
+	} else {
+		n.right = n.right.insert(other)
+	}
+
+	return n.update()
+}
+
+// remove deletes the item from the tree and returns the new root
+func (n *node) remove(it *item) *node {
+	if n == nil {
+		return nil
+	}
+
+	switch {
+	case n.item == it:
+		return merge(n.left, n.right)
+	case it.before(n.item):
+		n.left = n.left.remove(it)
+	default:
+		n.right = n.right.remove(it)
+	}
+
+	return n.update()
+}
+
+// split divides the tree into items before the item and the others
+func (n *node) split(it *item) (*node, *node) {
+	if n == nil {
+		return nil, nil
+	}
+
+	if n.item.before(it) {
+		left, right := n.right.split(it)
+		n.right = left
+
+		return n.update(), right
+	}
+
+	left, right := n.left.split(it)
+	n.left = right
+
+	return left, n.update()
+}
+
+// merge joins trees where all items of the left one are before items of the right one
+func merge(left, right *node) *node {
+	switch {
+	case left == nil:
+		return right
+	case right == nil:
+		return left
+	case left.priority > right.priority:
+		left.right = merge(left.right, right)
+
+		return left.update()
+	default:
+		right.left = merge(left, right.left)
+
+		return right.update()
+	}
+}
+
+func (n *node) first() *item {
+	for n.left != nil {
+		n = n.left
+	}
+
+	return n.item
+}
+
+// rank returns the number of items before the item
+func (n *node) rank(it *item) int {
+	var rank int
+	for n != nil {
+		switch {
+		case n.item == it:
+			return rank + n.left.len()
+		case it.before(n.item):
+			n = n.left
+		default:
+			rank += n.left.len() + 1
+			n = n.right
+		}
+	}
+
+	return rank
+}
+
+// walk calls the function for every item in order
+func (n *node) walk(fn func(it *item)) {
+	if n == nil {
+		return
+	}
+
+	n.left.walk(fn)
+	fn(n.item)
+	n.right.walk(fn)
+}
@@ -0,0 +1,174 @@
+package queue
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+func newDeadlineRequest(deadline time.Time) job.Request {
+	return job.Request{Ch: make(chan job.Response), ExpiredAt: deadline}
+}
+
+func TestDeadlineQueue(t *testing.T) {
+	Convey("Earliest deadline first", t, func() {
+		now := time.Now()
+		q := NewDeadlineQueue()
+		r1 := newDeadlineRequest(time.Time{})
+		r2 := newDeadlineRequest(now.Add(time.Hour))
+		r3 := newDeadlineRequest(now.Add(time.Minute))
+		r4 := newDeadlineRequest(time.Time{})
+		q.Push(r1)
+		q.Push(r2)
+		q.Push(r3)
+		q.Push(r4)
+
+		So(q.Len(), ShouldEqual, 4)
+
+		pos, ok := q.Position(r1.Ch)
+		So(ok, ShouldBeTrue)
+		So(pos, ShouldEqual, 3)
+
+		for _, expected := range []job.Request{r3, r2, r1, r4} {
+			r, ok := q.Pop()
+			So(ok, ShouldBeTrue)
+			So(r.Ch, ShouldEqual, expected.Ch)
+		}
+	})
+
+	Convey("Position, removal and weights", t, func() {
+		now := time.Now()
+		q := NewDeadlineQueue()
+		r1 := newDeadlineRequest(now.Add(time.Hour))
+		r2 := newDeadlineRequest(now.Add(time.Minute))
+		r2.Weight = 3
+		q.Push(r1)
+		q.Push(r2)
+
+		So(q.Weights(), ShouldResemble, []uint{3, 1})
+
+		pos, ok := q.Remove(r1.Ch)
+		So(ok, ShouldBeTrue)
+		So(pos, ShouldEqual, 2)
+
+		_, ok = q.Remove(r1.Ch)
+		So(ok, ShouldBeFalse)
+		_, ok = q.Position(r1.Ch)
+		So(ok, ShouldBeFalse)
+
+		// the request which wasn't dispatched is returned ahead of requests with the same deadline
+		r3 := newDeadlineRequest(r2.ExpiredAt)
+		q.Push(r3)
+		r, _ := q.Pop()
+		q.PushFront(r)
+		r, _ = q.Pop()
+		So(r.Ch, ShouldEqual, r2.Ch)
+	})
+
+	Convey("Request pushed to the front is ahead of all deadlines", t, func() {
+		now := time.Now()
+		q := NewDeadlineQueue()
+		r1 := newDeadlineRequest(now.Add(time.Minute))
+		r2 := newDeadlineRequest(time.Time{})
+		r3 := newDeadlineRequest(now.Add(time.Hour))
+		q.Push(r1)
+		q.PushFront(r2)
+		q.PushFront(r3)
+
+		pos, _ := q.Position(r2.Ch)
+		So(pos, ShouldEqual, 2)
+
+		for _, expected := range []job.Request{r3, r2, r1} {
+			r, ok := q.Pop()
+			So(ok, ShouldBeTrue)
+			So(r.Ch, ShouldEqual, expected.Ch)
+		}
+	})
+
+	Convey("Requests saved from expiry", t, func() {
+		now := time.Now()
+		q := NewDeadlineQueue()
+		r1 := newDeadlineRequest(time.Time{})
+		r2 := newDeadlineRequest(now.Add(time.Hour))
+		r3 := newDeadlineRequest(now.Add(10 * time.Millisecond))
+		q.Push(r1)
+		q.Push(r2)
+		q.Push(r3)
+
+		r, _ := q.Pop()
+		So(r.Ch, ShouldEqual, r3.Ch)
+
+		// r3 would wait for r2 in FIFO order
+		q.Pop()
+		So(q.Saved(), ShouldEqual, 0)
+
+		time.Sleep(20 * time.Millisecond)
+		q.Pop()
+		So(q.Saved(), ShouldEqual, 0)
+
+		r4 := newDeadlineRequest(time.Time{})
+		r5 := newDeadlineRequest(time.Now().Add(10 * time.Millisecond))
+		q.Push(r4)
+		q.Push(r5)
+		q.Pop()
+
+		time.Sleep(20 * time.Millisecond)
+		q.Remove(r4.Ch)
+		So(q.Saved(), ShouldEqual, 1)
+	})
+	Convey("Position matches the dispatching order", t, func() {
+		now := time.Now()
+		q := NewDeadlineQueue()
+		rnd := rand.New(rand.NewSource(1))
+
+		var queued []job.Request
+		for i := 0; i < 300; i++ {
+			var deadline time.Time
+			if rnd.Intn(3) > 0 {
+				deadline = now.Add(time.Duration(rnd.Intn(10)) * time.Second)
+			}
+
+			r := newDeadlineRequest(deadline)
+			if rnd.Intn(10) == 0 {
+				q.PushFront(r)
+			} else {
+				q.Push(r)
+			}
+			queued = append(queued, r)
+
+			switch rnd.Intn(4) {
+			case 0:
+				q.Pop()
+			case 1:
+				q.Remove(queued[rnd.Intn(len(queued))].Ch)
+			}
+		}
+
+		var order []*item
+		q.items.walk(func(it *item) {
+			order = append(order, it)
+		})
+		So(order, ShouldHaveLength, q.Len())
+		So(q.Weights(), ShouldHaveLength, q.Len())
+
+		for i, it := range order {
+			if i > 0 {
+				So(order[i-1].before(it), ShouldBeTrue)
+			}
+
+			pos, ok := q.Position(it.request.Ch)
+			So(ok, ShouldBeTrue)
+			So(pos, ShouldEqual, i+1)
+		}
+
+		for _, it := range order {
+			r, _ := q.Pop()
+			So(r.Ch, ShouldEqual, it.request.Ch)
+		}
+		So(q.submitted.Len(), ShouldEqual, 0)
+	})
+}
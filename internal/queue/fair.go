@@ -0,0 +1,423 @@
+package queue
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/chatex-com/rate-limiter/pkg/config"
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+var ErrZeroTenantWeight = errors.New("tenant weight must be a positive value")
+
+// statTTL is the time after the last request of the tenant when its counters are forgotten
+const statTTL = time.Hour
+
+// TenantStat is a snapshot of the tenant counters
+type TenantStat struct {
+	Weight uint
+	// Queued is the number of requests waiting in the queue
+	Queued int
+	// Dispatched is the number of requests passed to workers
+	Dispatched int64
+}
+
+// FairQueue keeps a FIFO sub-queue per tenant and dispatches requests
+// in deficit round robin order according to tenant weights.
+// A tenant leaves the round as soon as it has no queued requests,
+// its counters are kept till statTTL passes after its last request.
+type FairQueue struct {
+	cfg     config.FairQueue
+	tenants map[string]*tenant
+	stats   map[string]*tenantStat
+	purged  time.Time
+	byCh    map[<-chan job.Response]*list.Element
+	// active is the round robin of tenants with queued requests
+	active *list.List
+	// visiting is true if the tenant in the head of the round already got its quantum
+	visiting bool
+	mu       sync.Mutex
+	notify   chan struct{}
+}
+
+type tenant struct {
+	name    string
+	weight  uint
+	deficit uint
+	// slots is the number of slots taken by queued requests of the tenant
+	slots uint
+	items *list.List
+	elem  *list.Element
+}
+
+// tenantStat holds counters of the tenant independently of its queue
+type tenantStat struct {
+	weight     uint
+	dispatched int64
+	// active is the time of the last request of the tenant
+	active time.Time
+}
+
+func NewFairQueue(cfg config.FairQueue) (*FairQueue, error) {
+	if cfg.DefaultWeight == 0 {
+		return nil, ErrZeroTenantWeight
+	}
+
+	for _, weight := range cfg.Weights {
+		if weight == 0 {
+			return nil, ErrZeroTenantWeight
+		}
+	}
+
+	q := &FairQueue{
+		cfg:     cfg,
+		tenants: make(map[string]*tenant),
+		stats:   make(map[string]*tenantStat),
+		purged:  time.Now(),
+		byCh:    make(map[<-chan job.Response]*list.Element),
+		active:  list.New(),
+		notify:  make(chan struct{}, 1),
+	}
+
+	return q, nil
+}
+
+func (q *FairQueue) Push(r job.Request) {
+	q.mu.Lock()
+	t := q.tenant(r.Tenant)
+	q.byCh[r.Ch] = t.items.PushBack(r)
+	t.slots += r.Slots()
+	if t.elem == nil {
+		t.elem = q.active.PushBack(t)
+	}
+	q.mu.Unlock()
+
+	q.signal()
+}
+
+// PushFront returns the request to the head of the tenant queue
+// and gives the next turn to the tenant
+func (q *FairQueue) PushFront(r job.Request) {
+	q.mu.Lock()
+	t := q.tenant(r.Tenant)
+	q.byCh[r.Ch] = t.items.PushFront(r)
+	t.slots += r.Slots()
+	if t.elem == nil {
+		t.elem = q.active.PushFront(t)
+		q.visiting = false
+	}
+	q.mu.Unlock()
+
+	q.signal()
+}
+
+func (q *FairQueue) Wait(stop <-chan struct{}) bool {
+	return wait(q, q.notify, stop)
+}
+
+func (q *FairQueue) Pop() (job.Request, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.next()
+}
+
+func (q *FairQueue) Remove(ch <-chan job.Response) (int, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	e, ok := q.byCh[ch]
+	if !ok {
+		return 0, false
+	}
+
+	t := q.tenants[e.Value.(job.Request).Tenant]
+	pos := q.position(t, e)
+
+	t.items.Remove(e)
+	t.slots -= e.Value.(job.Request).Slots()
+	delete(q.byCh, ch)
+	q.deactivate(t)
+
+	return pos, true
+}
+
+func (q *FairQueue) Position(ch <-chan job.Response) (int, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	e, ok := q.byCh[ch]
+	if !ok {
+		return 0, false
+	}
+
+	return q.position(q.tenants[e.Value.(job.Request).Tenant], e), true
+}
+
+func (q *FairQueue) Weights() []uint {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	order := q.order()
+	weights := make([]uint, len(order))
+	for i, r := range order {
+		weights[i] = r.Slots()
+	}
+
+	return weights
+}
+
+// Ahead returns the number of slots of queued requests of the same tenant
+func (q *FairQueue) Ahead(r job.Request) uint {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if t, ok := q.tenants[r.Tenant]; ok {
+		return t.slots
+	}
+
+	return 0
+}
+
+func (q *FairQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.byCh)
+}
+
+// Stat returns counters of every tenant with a request within statTTL
+func (q *FairQueue) Stat() map[string]TenantStat {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.purge(time.Now())
+
+	stat := make(map[string]TenantStat, len(q.stats))
+	for name, s := range q.stats {
+		var queued int
+		if t, ok := q.tenants[name]; ok {
+			queued = t.items.Len()
+		}
+
+		stat[name] = TenantStat{
+			Weight:     s.weight,
+			Queued:     queued,
+			Dispatched: s.dispatched,
+		}
+	}
+
+	return stat
+}
+
+// next pops the request in deficit round robin order
+func (q *FairQueue) next() (job.Request, bool) {
+	for q.active.Len() > 0 {
+		t := q.active.Front().Value.(*tenant)
+		if !q.visiting {
+			t.deficit += t.weight
+			q.visiting = true
+		}
+
+		head := t.items.Front()
+		r := head.Value.(job.Request)
+		if t.deficit >= r.Slots() {
+			t.items.Remove(head)
+			delete(q.byCh, r.Ch)
+			t.slots -= r.Slots()
+			t.deficit -= r.Slots()
+			q.stat(t).dispatched++
+			q.deactivate(t)
+
+			return r, true
+		}
+
+		// the turn of the tenant is over, the deficit is kept till the next round
+		q.active.MoveToBack(t.elem)
+		q.visiting = false
+	}
+
+	return job.Request{}, false
+}
+
+// deactivate removes the tenant without queued requests from the round and forgets it
+func (q *FairQueue) deactivate(t *tenant) {
+	if t.items.Len() > 0 || t.elem == nil {
+		return
+	}
+
+	if q.active.Front() == t.elem {
+		q.visiting = false
+	}
+
+	q.active.Remove(t.elem)
+	delete(q.tenants, t.name)
+}
+
+// order simulates deficit round robin and returns queued requests in the dispatching order
+func (q *FairQueue) order() []job.Request {
+	type state struct {
+		t       *tenant
+		deficit uint
+		items   *list.Element
+	}
+
+	round := make([]*state, 0, q.active.Len())
+	var n int
+	for e := q.active.Front(); e != nil; e = e.Next() {
+		t := e.Value.(*tenant)
+		round = append(round, &state{t: t, deficit: t.deficit, items: t.items.Front()})
+		n += t.items.Len()
+	}
+
+	order := make([]job.Request, 0, n)
+	visiting := q.visiting
+	for len(round) > 0 {
+		s := round[0]
+		if !visiting {
+			s.deficit += s.t.weight
+			visiting = true
+		}
+
+		r := s.items.Value.(job.Request)
+		if s.deficit >= r.Slots() {
+			order = append(order, r)
+			s.deficit -= r.Slots()
+			s.items = s.items.Next()
+
+			if s.items == nil {
+				round = round[1:]
+				visiting = false
+			}
+
+			continue
+		}
+
+		round = append(round[1:], s)
+		visiting = false
+	}
+
+	return order
+}
+
+// position returns 1-based position of the queued element of the tenant in the dispatching order.
+// Tenants get their turns independently of each other: after n turns a tenant dispatches
+// its requests which fit into the sum of its deficit and n quantums. So the position is
+// the number of requests of every tenant dispatched till the turn of the element.
+func (q *FairQueue) position(t *tenant, elem *list.Element) int {
+	var slots uint
+	for e := t.items.Front(); ; e = e.Next() {
+		slots += e.Value.(job.Request).Slots()
+		if e == elem {
+			break
+		}
+	}
+
+	// turns of the tenant till the element is dispatched
+	var turns uint
+	if credit := q.credit(t); credit < slots {
+		turns = (slots - credit + t.weight - 1) / t.weight
+	}
+
+	pos := 0
+	before := true
+	for e := q.active.Front(); e != nil; e = e.Next() {
+		other := e.Value.(*tenant)
+		if other == t {
+			before = false
+		}
+
+		// tenants after the tenant in the round get one turn less
+		n := turns
+		if !before && other != t {
+			if turns == 0 {
+				continue
+			}
+			n--
+		}
+
+		credit := q.credit(other) + n*other.weight
+		for r := other.items.Front(); r != nil; r = r.Next() {
+			if other == t && r == elem {
+				break
+			}
+
+			slots := r.Value.(job.Request).Slots()
+			if slots > credit {
+				break
+			}
+
+			credit -= slots
+			pos++
+		}
+	}
+
+	return pos + 1
+}
+
+// credit returns the number of slots the tenant can dispatch on its next turn
+func (q *FairQueue) credit(t *tenant) uint {
+	if q.visiting && q.active.Front() == t.elem {
+		return t.deficit
+	}
+
+	return t.deficit + t.weight
+}
+
+func (q *FairQueue) tenant(name string) *tenant {
+	t, ok := q.tenants[name]
+	if !ok {
+		weight, ok := q.cfg.Weights[name]
+		if !ok {
+			weight = q.cfg.DefaultWeight
+		}
+
+		t = &tenant{
+			name:   name,
+			weight: weight,
+			items:  list.New(),
+		}
+		q.tenants[name] = t
+	}
+
+	q.stat(t)
+
+	return t
+}
+
+// stat returns counters of the tenant and marks the tenant active
+func (q *FairQueue) stat(t *tenant) *tenantStat {
+	now := time.Now()
+	if now.Sub(q.purged) > statTTL {
+		q.purge(now)
+	}
+
+	s, ok := q.stats[t.name]
+	if !ok {
+		s = &tenantStat{weight: t.weight}
+		q.stats[t.name] = s
+	}
+	s.active = now
+
+	return s
+}
+
+// purge forgets counters of tenants without queued requests and idle for statTTL
+func (q *FairQueue) purge(now time.Time) {
+	for name, s := range q.stats {
+		if _, queued := q.tenants[name]; !queued && now.Sub(s.active) > statTTL {
+			delete(q.stats, name)
+		}
+	}
+
+	q.purged = now
+}
+
+func (q *FairQueue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,169 @@
+package queue
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/chatex-com/rate-limiter/pkg/config"
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+func newTenantRequest(tenant string, weight uint) job.Request {
+	return job.Request{Ch: make(chan job.Response), Tenant: tenant, Weight: weight}
+}
+
+func popTenants(q Scheduler, n int) []string {
+	tenants := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		r, _ := q.Pop()
+		tenants = append(tenants, r.Tenant)
+	}
+
+	return tenants
+}
+
+func TestNewFairQueue(t *testing.T) {
+	Convey("Zero weights", t, func() {
+		cfg := config.NewFairQueue()
+		cfg.DefaultWeight = 0
+		_, err := NewFairQueue(*cfg)
+		So(err, ShouldEqual, ErrZeroTenantWeight)
+
+		_, err = NewFairQueue(*config.NewFairQueue().SetWeight("foo", 0))
+		So(err, ShouldEqual, ErrZeroTenantWeight)
+	})
+}
+
+func TestFairQueue(t *testing.T) {
+	Convey("Noisy tenant doesn't delay others", t, func() {
+		q, _ := NewFairQueue(*config.NewFairQueue())
+		for i := 0; i < 5; i++ {
+			q.Push(newTenantRequest("noisy", 0))
+		}
+		q.Push(newTenantRequest("foo", 0))
+		q.Push(newTenantRequest("bar", 0))
+
+		So(q.Len(), ShouldEqual, 7)
+		So(popTenants(q, 5), ShouldResemble, []string{"noisy", "foo", "bar", "noisy", "noisy"})
+	})
+
+	Convey("Slots are dispatched according to weights", t, func() {
+		q, _ := NewFairQueue(*config.NewFairQueue().SetWeight("foo", 2))
+		for i := 0; i < 4; i++ {
+			q.Push(newTenantRequest("foo", 0))
+			q.Push(newTenantRequest("bar", 0))
+		}
+		// heavy request waits till the deficit is accumulated
+		q.Push(newTenantRequest("baz", 2))
+
+		So(q.Weights(), ShouldResemble, []uint{1, 1, 1, 1, 1, 1, 2, 1, 1})
+		So(popTenants(q, 9), ShouldResemble, []string{
+			"foo", "foo", "bar", "foo", "foo", "bar", "baz", "bar", "bar",
+		})
+	})
+
+	Convey("Position and removal in the dispatching order", t, func() {
+		q, _ := NewFairQueue(*config.NewFairQueue())
+		r1 := newTenantRequest("foo", 0)
+		r2 := newTenantRequest("foo", 0)
+		r3 := newTenantRequest("bar", 0)
+		q.Push(r1)
+		q.Push(r2)
+		q.Push(r3)
+
+		pos, ok := q.Position(r3.Ch)
+		So(ok, ShouldBeTrue)
+		So(pos, ShouldEqual, 2)
+
+		pos, ok = q.Remove(r3.Ch)
+		So(ok, ShouldBeTrue)
+		So(pos, ShouldEqual, 2)
+
+		_, ok = q.Remove(r3.Ch)
+		So(ok, ShouldBeFalse)
+
+		pos, _ = q.Position(r2.Ch)
+		So(pos, ShouldEqual, 2)
+
+		r, _ := q.Pop()
+		So(r.Ch, ShouldEqual, r1.Ch)
+
+		// the request which wasn't dispatched is returned to the head
+		q.PushFront(r)
+		pos, _ = q.Position(r1.Ch)
+		So(pos, ShouldEqual, 1)
+	})
+
+	Convey("Position matches the dispatching order", t, func() {
+		q, _ := NewFairQueue(*config.NewFairQueue().SetWeight("foo", 2).SetWeight("bar", 3))
+		tenants := []string{"foo", "bar", "baz"}
+		rnd := rand.New(rand.NewSource(1))
+
+		for i := 0; i < 200; i++ {
+			q.Push(newTenantRequest(tenants[rnd.Intn(len(tenants))], uint(rnd.Intn(4))))
+			if rnd.Intn(3) == 0 {
+				q.Pop()
+			}
+
+			if order := q.order(); len(order) > 0 && rnd.Intn(4) == 0 {
+				k := rnd.Intn(len(order))
+				pos, ok := q.Remove(order[k].Ch)
+				So(ok, ShouldBeTrue)
+				So(pos, ShouldEqual, k+1)
+			}
+
+			for i, r := range q.order() {
+				pos, ok := q.Position(r.Ch)
+				So(ok, ShouldBeTrue)
+				So(pos, ShouldEqual, i+1)
+			}
+		}
+	})
+
+	Convey("Slots of the same tenant are ahead of a new request", t, func() {
+		q, _ := NewFairQueue(*config.NewFairQueue())
+		r1 := newTenantRequest("foo", 2)
+		q.Push(r1)
+		q.Push(newTenantRequest("foo", 0))
+		q.Push(newTenantRequest("bar", 0))
+
+		So(q.Ahead(newTenantRequest("foo", 0)), ShouldEqual, 3)
+		So(q.Ahead(newTenantRequest("baz", 0)), ShouldEqual, 0)
+
+		q.Remove(r1.Ch)
+		So(q.Ahead(newTenantRequest("foo", 0)), ShouldEqual, 1)
+	})
+
+	Convey("Stat per tenant", t, func() {
+		q, _ := NewFairQueue(*config.NewFairQueue().SetWeight("foo", 3))
+		q.Push(newTenantRequest("foo", 0))
+		q.Push(newTenantRequest("foo", 0))
+		q.Push(newTenantRequest("bar", 0))
+		q.Pop()
+
+		So(q.Stat(), ShouldResemble, map[string]TenantStat{
+			"foo": {Weight: 3, Queued: 1, Dispatched: 1},
+			"bar": {Weight: 1, Queued: 1, Dispatched: 0},
+		})
+
+		// counters are kept after the queue of the tenant is empty
+		q.Pop()
+		q.Pop()
+		q.Push(newTenantRequest("foo", 0))
+		So(q.tenants, ShouldHaveLength, 1)
+		So(q.Stat(), ShouldResemble, map[string]TenantStat{
+			"foo": {Weight: 3, Queued: 1, Dispatched: 2},
+			"bar": {Weight: 1, Queued: 0, Dispatched: 1},
+		})
+
+		// counters of idle tenants expire
+		q.stats["bar"].active = time.Now().Add(-statTTL - time.Second)
+		q.stats["foo"].active = time.Now().Add(-statTTL - time.Second)
+		So(q.Stat(), ShouldResemble, map[string]TenantStat{
+			"foo": {Weight: 3, Queued: 1, Dispatched: 2},
+		})
+	})
+}
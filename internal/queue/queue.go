@@ -0,0 +1,180 @@
+package queue
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+// Scheduler keeps requests waiting for a worker and defines the order of their dispatching.
+// Requests are identified by their response channels.
+type Scheduler interface {
+	Push(r job.Request)
+	// PushFront returns the request to the head of the queue (e.g. it wasn't dispatched)
+	PushFront(r job.Request)
+	// Wait blocks till a request is queued or stop channel is closed.
+	// Only one goroutine is allowed to wait for requests.
+	Wait(stop <-chan struct{}) bool
+	// Pop takes the next request in the dispatching order. It returns false if the queue is empty.
+	Pop() (job.Request, bool)
+	// Remove deletes the request from the queue and returns its 1-based position.
+	// It returns false if the request is not in the queue.
+	Remove(ch <-chan job.Response) (int, bool)
+	// Position returns 1-based position of the request in the dispatching order
+	Position(ch <-chan job.Response) (int, bool)
+	// Weights returns the number of slots taken by every queued request in the dispatching order
+	Weights() []uint
+	// Ahead returns the number of slots of queued requests which would be dispatched
+	// before the request for sure if it was pushed now. It's computed in constant time.
+	Ahead(r job.Request) uint
+	Len() int
+}
+
+// Queue is a FIFO queue of requests waiting for a worker.
+// Requests are identified by their response channels.
+type Queue struct {
+	items *list.List
+	// slots is the number of slots taken by queued requests
+	slots  uint
+	mu     sync.Mutex
+	notify chan struct{}
+}
+
+func NewQueue() *Queue {
+	return &Queue{
+		items:  list.New(),
+		notify: make(chan struct{}, 1),
+	}
+}
+
+func (q *Queue) Push(r job.Request) {
+	q.mu.Lock()
+	q.items.PushBack(r)
+	q.slots += r.Slots()
+	q.mu.Unlock()
+
+	q.signal()
+}
+
+// PushFront returns the request to the head of the queue (e.g. it wasn't dispatched)
+func (q *Queue) PushFront(r job.Request) {
+	q.mu.Lock()
+	q.items.PushFront(r)
+	q.slots += r.Slots()
+	q.mu.Unlock()
+
+	q.signal()
+}
+
+// Wait blocks till a request is queued or stop channel is closed.
+// Only one goroutine is allowed to wait for requests.
+func (q *Queue) Wait(stop <-chan struct{}) bool {
+	return wait(q, q.notify, stop)
+}
+
+// Pop takes the request from the head of the queue. It returns false if the queue is empty.
+func (q *Queue) Pop() (job.Request, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	e := q.items.Front()
+	if e == nil {
+		return job.Request{}, false
+	}
+
+	q.remove(e)
+
+	return e.Value.(job.Request), true
+}
+
+// Remove deletes the request from the queue and returns its 1-based position.
+// It returns false if the request is not in the queue.
+func (q *Queue) Remove(ch <-chan job.Response) (int, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	e, pos := q.find(ch)
+	if e == nil {
+		return 0, false
+	}
+
+	q.remove(e)
+
+	return pos, true
+}
+
+// Position returns 1-based position of the request in the queue
+func (q *Queue) Position(ch <-chan job.Response) (int, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	e, pos := q.find(ch)
+
+	return pos, e != nil
+}
+
+// Weights returns the number of slots taken by every queued request in the queue order
+func (q *Queue) Weights() []uint {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	weights := make([]uint, 0, q.items.Len())
+	for e := q.items.Front(); e != nil; e = e.Next() {
+		weights = append(weights, e.Value.(job.Request).Slots())
+	}
+
+	return weights
+}
+
+// Ahead returns the number of slots of all queued requests
+func (q *Queue) Ahead(job.Request) uint {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.slots
+}
+
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.items.Len()
+}
+
+func (q *Queue) remove(e *list.Element) {
+	q.items.Remove(e)
+	q.slots -= e.Value.(job.Request).Slots()
+}
+
+func (q *Queue) find(ch <-chan job.Response) (*list.Element, int) {
+	pos := 1
+	for e := q.items.Front(); e != nil; e = e.Next() {
+		if e.Value.(job.Request).Ch == ch {
+			return e, pos
+		}
+		pos++
+	}
+
+	return nil, 0
+}
+
+// wait blocks till the scheduler isn't empty or stop channel is closed
+func wait(s Scheduler, notify <-chan struct{}, stop <-chan struct{}) bool {
+	for s.Len() == 0 {
+		select {
+		case <-notify:
+		case <-stop:
+			return false
+		}
+	}
+
+	return true
+}
+
+func (q *Queue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
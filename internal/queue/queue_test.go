@@ -0,0 +1,111 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+func newRequest() job.Request {
+	return job.Request{Ch: make(chan job.Response)}
+}
+
+func TestQueue(t *testing.T) {
+	Convey("FIFO order", t, func() {
+		q := NewQueue()
+		r1 := newRequest()
+		r2 := newRequest()
+		r3 := newRequest()
+		q.Push(r1)
+		q.Push(r2)
+		q.PushFront(r3)
+
+		So(q.Len(), ShouldEqual, 3)
+
+		r, ok := q.Pop()
+		So(ok, ShouldBeTrue)
+		So(r.Ch, ShouldEqual, r3.Ch)
+
+		r, _ = q.Pop()
+		So(r.Ch, ShouldEqual, r1.Ch)
+	})
+
+	Convey("Position and removal", t, func() {
+		q := NewQueue()
+		r1 := newRequest()
+		r2 := newRequest()
+		q.Push(r1)
+		q.Push(r2)
+
+		pos, ok := q.Position(r2.Ch)
+		So(ok, ShouldBeTrue)
+		So(pos, ShouldEqual, 2)
+
+		pos, ok = q.Remove(r1.Ch)
+		So(ok, ShouldBeTrue)
+		So(pos, ShouldEqual, 1)
+
+		_, ok = q.Remove(r1.Ch)
+		So(ok, ShouldBeFalse)
+
+		pos, _ = q.Position(r2.Ch)
+		So(pos, ShouldEqual, 1)
+	})
+
+	Convey("Wait for a request", t, func() {
+		q := NewQueue()
+		r1 := newRequest()
+
+		_, ok := q.Pop()
+		So(ok, ShouldBeFalse)
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			q.Push(r1)
+		}()
+
+		So(q.Wait(nil), ShouldBeTrue)
+
+		r, ok := q.Pop()
+		So(ok, ShouldBeTrue)
+		So(r.Ch, ShouldEqual, r1.Ch)
+	})
+
+	Convey("Slots ahead of a new request", t, func() {
+		q := NewQueue()
+		So(q.Ahead(newRequest()), ShouldEqual, 0)
+
+		r1 := newRequest()
+		r1.Weight = 3
+		q.Push(r1)
+		q.Push(newRequest())
+		So(q.Ahead(newRequest()), ShouldEqual, 4)
+
+		q.Remove(r1.Ch)
+		So(q.Ahead(newRequest()), ShouldEqual, 1)
+
+		q.Pop()
+		So(q.Ahead(newRequest()), ShouldEqual, 0)
+	})
+
+	Convey("Wait is stopped", t, func() {
+		q := NewQueue()
+		stop := make(chan struct{})
+		close(stop)
+
+		So(q.Wait(stop), ShouldBeFalse)
+	})
+}
+
+func TestWeights(t *testing.T) {
+	Convey("Weights in queue order", t, func() {
+		q := NewQueue()
+		q.Push(job.Request{Ch: make(chan job.Response), Weight: 3})
+		q.Push(job.Request{Ch: make(chan job.Response)})
+
+		So(q.Weights(), ShouldResemble, []uint{3, 1})
+	})
+}
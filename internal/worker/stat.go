@@ -4,4 +4,5 @@ type Stat struct {
 	InProcess int64
 	Error     int64
 	Done      int64
+	Refunded  int64
 }
@@ -0,0 +1,14 @@
+package worker
+
+import (
+	"time"
+
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+// Waiting is the request taken by a worker from the queue which isn't started yet
+type Waiting struct {
+	Request job.Request
+	// Since is the time when the worker took the request
+	Since time.Time
+}
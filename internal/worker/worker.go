@@ -1,21 +1,38 @@
 package worker
 
 import (
+	"errors"
+	"log/slog"
+	"runtime/debug"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/chatex-com/rate-limiter/internal/adaptive"
+	"github.com/chatex-com/rate-limiter/internal/breaker"
+	"github.com/chatex-com/rate-limiter/internal/events"
 	"github.com/chatex-com/rate-limiter/internal/limiter"
+	"github.com/chatex-com/rate-limiter/internal/logging"
+	"github.com/chatex-com/rate-limiter/pkg/config"
+	"github.com/chatex-com/rate-limiter/pkg/event"
 	"github.com/chatex-com/rate-limiter/pkg/job"
 )
 
 type Worker struct {
 	quotas        *limiter.QuotaGroup
 	requests      <-chan job.Request
+	ready         chan<- struct{}
 	wg            *sync.WaitGroup
 	isRunning     bool
 	isRunningLock sync.RWMutex
 	stat          Stat
+	waiting       *Waiting
+	waitingLock   sync.Mutex
+	adaptive      *adaptive.Limiter
+	breakers      *breaker.Group
+	shadow        *limiter.Shadow
+	events        *events.Emitter
+	logger        *logging.Logger
 }
 
 func NewWorker(quotas *limiter.QuotaGroup, requests <-chan job.Request, wg *sync.WaitGroup) *Worker {
@@ -26,6 +43,65 @@ func NewWorker(quotas *limiter.QuotaGroup, requests <-chan job.Request, wg *sync
 	}
 }
 
+// SetReady sets the channel which receives a token every time the worker completes
+// a request, so the sender of requests knows that a worker is free.
+// It must be called before the worker is started.
+func (w *Worker) SetReady(ready chan<- struct{}) {
+	w.ready = ready
+}
+
+// SetAdaptiveLimiter sets the limiter of jobs in flight shared between workers.
+// The slot is acquired before the request is passed to the worker and the worker
+// frees it when the job is completed. It must be called before the worker is started.
+func (w *Worker) SetAdaptiveLimiter(l *adaptive.Limiter) {
+	w.adaptive = l
+}
+
+// SetCircuitBreakers sets circuit breakers shared between workers.
+// It must be called before the worker is started.
+func (w *Worker) SetCircuitBreakers(g *breaker.Group) {
+	w.breakers = g
+}
+
+// SetShadow sets quotas which are evaluated for every job but not enforced.
+// It must be called before the worker is started.
+func (w *Worker) SetShadow(s *limiter.Shadow) {
+	w.shadow = s
+}
+
+// SetEmitter sets the emitter of job lifecycle events.
+// It must be called before the worker is started.
+func (w *Worker) SetEmitter(e *events.Emitter) {
+	w.events = e
+}
+
+// SetLogger sets the logger. It must be called before the worker is started.
+func (w *Worker) SetLogger(l *logging.Logger) {
+	w.logger = l
+}
+
+func (w *Worker) Stat() Stat {
+	return Stat{
+		InProcess: atomic.LoadInt64(&w.stat.InProcess),
+		Error:     atomic.LoadInt64(&w.stat.Error),
+		Done:      atomic.LoadInt64(&w.stat.Done),
+		Refunded:  atomic.LoadInt64(&w.stat.Refunded),
+	}
+}
+
+// Waiting returns the request taken by the worker which waits for a free slot.
+// It returns false if the worker doesn't hold such a request.
+func (w *Worker) Waiting() (Waiting, bool) {
+	w.waitingLock.Lock()
+	defer w.waitingLock.Unlock()
+
+	if w.waiting == nil {
+		return Waiting{}, false
+	}
+
+	return *w.waiting, true
+}
+
 func (w *Worker) Start() {
 	w.isRunningLock.Lock()
 	defer w.isRunningLock.Unlock()
@@ -35,6 +111,7 @@ func (w *Worker) Start() {
 	}
 
 	w.isRunning = true
+	w.logger.Debug("worker started")
 
 	go w.loop()
 }
@@ -48,6 +125,7 @@ func (w *Worker) Stop() {
 	}
 
 	w.isRunning = false
+	w.logger.Debug("worker stopped")
 }
 
 func (w *Worker) IsRunning() bool {
@@ -60,41 +138,164 @@ func (w *Worker) IsRunning() bool {
 func (w *Worker) loop() {
 	for w.IsRunning() {
 		request := <-w.requests
+		w.hold(request)
+		w.events.Emit(event.Dequeued, request)
 
 		if request.IsExpired() {
-			w.error(request, job.ErrJobExpired)
+			w.cancel()
+			w.error(request, &job.ExpiredError{})
 			continue
 		}
 
-		err := w.reserveFreeSlot(request)
+		if err := request.Context().Err(); err != nil {
+			w.cancel()
+			w.error(request, err)
+			continue
+		}
+
+		generation, err := w.allow(request)
 		if err != nil {
+			w.cancel()
 			w.error(request, err)
 			continue
 		}
 
-		w.execute(request)
+		reservation, err := w.reserveFreeSlot(&request)
+		if err != nil {
+			w.cancel()
+			w.cancelProbe(request, generation)
+			w.error(request, err)
+			continue
+		}
+
+		w.execute(request, reservation, generation)
 	}
 }
 
-func (w *Worker) reserveFreeSlot(request job.Request) error {
+func (w *Worker) reserveFreeSlot(request *job.Request) (job.Reservation, error) {
+	if request.Reservation != nil {
+		booked, ok := request.Reservation.(*limiter.Reservation)
+		if !ok || !booked.Booked() {
+			return request.Reservation, nil
+		}
+
+		// the job can be started later than the booked time, so the slots
+		// are moved to the actual start and concurrency slots are taken
+		if booked.Move(time.Now()) == nil {
+			return booked, nil
+		}
+
+		// the job waits for free slots like others, including busy concurrency quotas
+		booked.Refund()
+		request.Reservation = nil
+	}
+
+	var start time.Time
 	for {
-		free, wait := w.quotas.ReserveFreeSlot()
+		released := w.quotas.Released()
+		reservation, wait, exhausted := w.quotas.ReservePath(request.Key, request.Path, request.Slots())
+
+		if reservation != nil {
+			w.waitFinished(*request, start, nil)
+
+			return reservation, nil
+		}
+
+		var err error
+		switch {
+		case request.IsExpiredAfter(wait):
+			err = &job.ExpiredError{Wait: wait, Quotas: exhausted}
+		case w.breakers != nil && w.breakers.IsOpen(request.Key):
+			err = job.ErrCircuitOpen
+		}
 
-		if free {
-			return nil
+		if err != nil {
+			w.waitFinished(*request, start, err)
+
+			return nil, err
+		}
+
+		if start.IsZero() {
+			start = time.Now()
+			w.events.Emit(event.WaitStarted, *request, events.WithWait(wait))
+			w.logger.Sampled(slog.LevelInfo, "quota exhausted",
+				slog.String("key", request.Key), slog.Duration("wait", wait), slog.Any("quotas", exhausted))
 		}
 
-		if request.IsExpiredAfter(wait) {
-			return job.ErrJobExpired
+		// a busy concurrency quota is waited till a running job releases the slot
+		if !hasConcurrency(exhausted) {
+			released = nil
+		}
+
+		var timeout <-chan time.Time
+		switch {
+		case wait > 0:
+			timeout = time.After(wait)
+		case !request.ExpiredAt.IsZero():
+			timeout = time.After(time.Until(request.ExpiredAt))
+		}
+
+		select {
+		case <-timeout:
+		case <-released:
+		case <-request.Context().Done():
+			w.waitFinished(*request, start, request.Context().Err())
+
+			return nil, request.Context().Err()
+		}
+	}
+}
+
+// hasConcurrency checks if any of exhausted quotas is a concurrency quota
+func hasConcurrency(exhausted []config.Quota) bool {
+	for _, q := range exhausted {
+		if q.Type == config.QuotaTypeConcurrency {
+			return true
 		}
+	}
+
+	return false
+}
 
-		<-time.After(wait)
+// waitFinished emits the event if the request was waiting for a free slot
+func (w *Worker) waitFinished(request job.Request, start time.Time, err error) {
+	if start.IsZero() {
+		return
 	}
+
+	w.events.Emit(event.WaitFinished, request, events.WithWait(time.Since(start)), events.WithErr(err))
 }
 
-func (w *Worker) execute(request job.Request) {
+func (w *Worker) execute(request job.Request, reservation job.Reservation, generation breaker.Generation) {
+	w.unhold()
 	atomic.AddInt64(&w.stat.InProcess, 1)
-	result, err := request.Job()
+	shadow := w.evaluateShadow(request)
+	w.events.Emit(event.Started, request)
+	start := time.Now()
+	result, err := w.run(request)
+	latency := time.Since(start)
+	reservation.Release()
+
+	if shadow != nil {
+		shadow.Release()
+	}
+
+	if errors.Is(err, job.ErrNotCounted) {
+		reservation.Refund()
+
+		if shadow != nil {
+			shadow.Refund()
+		}
+
+		atomic.AddInt64(&w.stat.Refunded, 1)
+		w.cancel()
+		w.cancelProbe(request, generation)
+	} else {
+		w.release(latency, err)
+		w.done(request, generation, err)
+	}
+
+	w.events.Emit(event.Finished, request, events.WithLatency(latency), events.WithErr(err))
 
 	request.Ch <- job.Response{
 		Result: result,
@@ -110,10 +311,40 @@ func (w *Worker) execute(request job.Request) {
 
 	close(request.Ch)
 
+	w.free()
 	w.wg.Done()
 }
 
+// run executes the job and recovers its panic
+func (w *Worker) run(request job.Request) (result interface{}, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &job.PanicError{Value: v, Stack: debug.Stack()}
+			w.events.Emit(event.Panicked, request, events.WithPanic(v))
+			w.logger.Error("job panicked", slog.String("key", request.Key), slog.Any("panic", v))
+		}
+	}()
+
+	return request.Run()
+}
+
 func (w *Worker) error(request job.Request, err error) {
+	w.unhold()
+
+	// the slot reserved before queueing wasn't used
+	if request.Reservation != nil {
+		request.Reservation.Refund()
+		request.Reservation.Release()
+	}
+
+	if errors.Is(err, job.ErrJobExpired) {
+		w.events.Emit(event.Expired, request, events.WithErr(err))
+		w.logger.Sampled(slog.LevelWarn, "job expired", slog.String("key", request.Key), slog.Any("error", err))
+	} else {
+		w.events.Emit(event.Rejected, request, events.WithErr(err))
+		w.logger.Sampled(slog.LevelWarn, "job rejected", slog.String("key", request.Key), slog.Any("error", err))
+	}
+
 	request.Ch <- job.Response{
 		Result: nil,
 		Error:  err,
@@ -122,5 +353,69 @@ func (w *Worker) error(request job.Request, err error) {
 	atomic.AddInt64(&w.stat.Error, 1)
 	close(request.Ch)
 
+	w.free()
 	w.wg.Done()
 }
+
+// evaluateShadow returns the reservation of shadow quotas or nil
+func (w *Worker) evaluateShadow(request job.Request) *limiter.Reservation {
+	if w.shadow == nil {
+		return nil
+	}
+
+	return w.shadow.Evaluate(request.Key, request.Path, request.Slots(), request.ExpiredAt)
+}
+
+// hold remembers the request taken by the worker till it is started or failed
+func (w *Worker) hold(request job.Request) {
+	w.waitingLock.Lock()
+	defer w.waitingLock.Unlock()
+
+	w.waiting = &Waiting{Request: request, Since: time.Now()}
+}
+
+func (w *Worker) unhold() {
+	w.waitingLock.Lock()
+	defer w.waitingLock.Unlock()
+
+	w.waiting = nil
+}
+
+// free reports that the worker is ready for the next request
+func (w *Worker) free() {
+	if w.ready != nil {
+		w.ready <- struct{}{}
+	}
+}
+
+func (w *Worker) release(latency time.Duration, err error) {
+	if w.adaptive != nil {
+		w.adaptive.Release(latency, err)
+	}
+}
+
+func (w *Worker) cancel() {
+	if w.adaptive != nil {
+		w.adaptive.Cancel()
+	}
+}
+
+func (w *Worker) allow(request job.Request) (breaker.Generation, error) {
+	if w.breakers == nil {
+		return breaker.Generation{}, nil
+	}
+
+	return w.breakers.Allow(request.Key)
+}
+
+func (w *Worker) done(request job.Request, generation breaker.Generation, err error) {
+	if w.breakers != nil {
+		w.breakers.Done(request.Key, generation, err)
+	}
+}
+
+func (w *Worker) cancelProbe(request job.Request, generation breaker.Generation) {
+	if w.breakers != nil {
+		w.breakers.Cancel(request.Key, generation)
+	}
+}
@@ -1,12 +1,15 @@
 package worker
 
 import (
+	"errors"
+	"fmt"
 	"sync"
 	"testing"
 	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 
+	"github.com/chatex-com/rate-limiter/internal/breaker"
 	"github.com/chatex-com/rate-limiter/internal/limiter"
 	"github.com/chatex-com/rate-limiter/pkg/config"
 	"github.com/chatex-com/rate-limiter/pkg/job"
@@ -157,6 +160,117 @@ func TestLoop(t *testing.T) {
 		So(worker.stat.Done, ShouldBeZeroValue)
 	})
 
+	Convey("Not counted job execution refunds the slot", t, func() {
+		quotas, _ := limiter.NewQuotaGroup([]config.Quota{
+			*config.NewQuota(1, time.Hour),
+		})
+		wg := &sync.WaitGroup{}
+		requests := make(chan job.Request)
+		worker := NewWorker(quotas, requests, wg)
+		worker.Start()
+
+		request := job.Request{
+			Job: func() (interface{}, error) {
+				return nil, fmt.Errorf("invalid request: %w", job.ErrNotCounted)
+			},
+			Ch: make(chan job.Response),
+		}
+
+		wg.Add(1)
+		requests <- request
+
+		resp := <-request.Ch
+		So(resp.Error, ShouldBeError)
+		So(errors.Is(resp.Error, job.ErrNotCounted), ShouldBeTrue)
+
+		wg.Wait()
+		So(worker.stat.Error, ShouldEqual, 1)
+		So(worker.stat.Refunded, ShouldEqual, 1)
+
+		free, _ := quotas.ReserveFreeSlot()
+		So(free, ShouldBeTrue)
+	})
+
+	Convey("Concurrency slot is released after job execution", t, func() {
+		quotas, _ := limiter.NewQuotaGroup([]config.Quota{
+			*config.NewConcurrencyQuota(1),
+		})
+		wg := &sync.WaitGroup{}
+		requests := make(chan job.Request)
+		worker := NewWorker(quotas, requests, wg)
+		worker.Start()
+
+		request := job.Request{
+			Job: func() (interface{}, error) {
+				free, _ := quotas.ReserveFreeSlot()
+				return free, nil
+			},
+			Ch: make(chan job.Response),
+		}
+
+		wg.Add(1)
+		requests <- request
+
+		resp := <-request.Ch
+		So(resp.Result, ShouldBeFalse)
+
+		wg.Wait()
+		free, _ := quotas.ReserveFreeSlot()
+		So(free, ShouldBeTrue)
+	})
+
+	Convey("Waiting job is started on release of the concurrency slot", t, func() {
+		quotas, _ := limiter.NewQuotaGroup([]config.Quota{
+			*config.NewConcurrencyQuota(1),
+		})
+		wg := &sync.WaitGroup{}
+		requests := make(chan job.Request)
+		NewWorker(quotas, requests, wg).Start()
+		NewWorker(quotas, requests, wg).Start()
+
+		finish := make(chan struct{})
+		first := job.Request{
+			Job: func() (interface{}, error) {
+				<-finish
+				return nil, nil
+			},
+			Ch: make(chan job.Response),
+		}
+		second := job.Request{
+			Job: func() (interface{}, error) {
+				return time.Now(), nil
+			},
+			Ch: make(chan job.Response),
+		}
+		expiring := job.Request{
+			Job: func() (interface{}, error) {
+				return nil, nil
+			},
+			Ch:        make(chan job.Response),
+			ExpiredAt: time.Now().Add(20 * time.Millisecond),
+		}
+
+		wg.Add(3)
+		requests <- first
+		requests <- expiring
+
+		resp := <-expiring.Ch
+		So(errors.Is(resp.Error, job.ErrJobExpired), ShouldBeTrue)
+
+		requests <- second
+		time.Sleep(20 * time.Millisecond)
+
+		released := time.Now()
+		close(finish)
+		<-first.Ch
+
+		resp = <-second.Ch
+		So(resp.Error, ShouldBeNil)
+		So(resp.Result.(time.Time).Sub(released), ShouldBeLessThan, 5*time.Millisecond)
+
+		wg.Wait()
+	})
+
 	Convey("Expired job execution", t, func() {
 		quotas, _ := limiter.NewQuotaGroup([]config.Quota{})
 		wg := &sync.WaitGroup{}
@@ -183,7 +297,7 @@ func TestLoop(t *testing.T) {
 		So(resp, ShouldHaveSameTypeAs, job.Response{})
 		So(resp.Result, ShouldBeNil)
 		So(resp.Error, ShouldBeError)
-		So(resp.Error, ShouldEqual, job.ErrJobExpired)
+		So(resp.Error, ShouldResemble, &job.ExpiredError{})
 
 		wg.Wait()
 		So(worker.stat.Error, ShouldEqual, 1)
@@ -231,7 +345,7 @@ func TestLoop(t *testing.T) {
 		So(resp2, ShouldHaveSameTypeAs, job.Response{})
 		So(resp2.Result, ShouldBeNil)
 		So(resp2.Error, ShouldBeError)
-		So(resp2.Error, ShouldEqual, job.ErrJobExpired)
+		So(errors.Is(resp2.Error, job.ErrJobExpired), ShouldBeTrue)
 
 		wg.Wait()
 		So(worker.stat.Error, ShouldEqual, 1)
@@ -239,6 +353,48 @@ func TestLoop(t *testing.T) {
 	})
 }
 
+func TestCircuitBreaker(t *testing.T) {
+	Convey("Queued jobs fail fast when circuit breaker is open", t, func() {
+		quotas, _ := limiter.NewQuotaGroup([]config.Quota{})
+		breakers, _ := breaker.NewGroup(*config.NewCircuitBreaker(1, time.Hour))
+		wg := &sync.WaitGroup{}
+		requests := make(chan job.Request, 2)
+		worker := NewWorker(quotas, requests, wg)
+		worker.SetCircuitBreakers(breakers)
+		worker.Start()
+
+		executed := 0
+		newRequest := func() job.Request {
+			return job.Request{
+				Job: func() (interface{}, error) {
+					executed++
+					return nil, errors.New("upstream is down")
+				},
+				Ch:  make(chan job.Response),
+				Key: "foo",
+			}
+		}
+		request1 := newRequest()
+		request2 := newRequest()
+
+		wg.Add(2)
+		requests <- request1
+		requests <- request2
+
+		resp1 := <-request1.Ch
+		So(resp1.Error, ShouldBeError)
+
+		resp2 := <-request2.Ch
+		So(resp2.Error, ShouldEqual, job.ErrCircuitOpen)
+
+		wg.Wait()
+		So(executed, ShouldEqual, 1)
+		So(breakers.Get("foo").IsOpen(), ShouldBeTrue)
+		So(breakers.Get("").IsOpen(), ShouldBeTrue)
+		So(breakers.Get("bar").IsOpen(), ShouldBeFalse)
+	})
+}
+
 func TestReserveFreeSlot(t *testing.T) {
 	Convey("Empty queue", t, func() {
 		quotas, _ := limiter.NewQuotaGroup([]config.Quota{
@@ -247,7 +403,7 @@ func TestReserveFreeSlot(t *testing.T) {
 		worker := NewWorker(quotas, make(chan job.Request), &sync.WaitGroup{})
 		request := job.Request{}
 
-		err := worker.reserveFreeSlot(request)
+		_, err := worker.reserveFreeSlot(&request)
 
 		So(err, ShouldBeNil)
 	})
@@ -259,8 +415,8 @@ func TestReserveFreeSlot(t *testing.T) {
 		worker := NewWorker(quotas, make(chan job.Request), &sync.WaitGroup{})
 		request := job.Request{}
 
-		_ = worker.reserveFreeSlot(request)
-		err := worker.reserveFreeSlot(request)
+		_, _ = worker.reserveFreeSlot(&request)
+		_, err := worker.reserveFreeSlot(&request)
 
 		So(err, ShouldBeNil)
 	})
@@ -272,10 +428,15 @@ func TestReserveFreeSlot(t *testing.T) {
 		worker := NewWorker(quotas, make(chan job.Request), &sync.WaitGroup{})
 		request := job.Request{ExpiredAt: time.Now().Add(- time.Hour)}
 
-		_ = worker.reserveFreeSlot(request)
-		err := worker.reserveFreeSlot(request)
+		_, _ = worker.reserveFreeSlot(&request)
+		_, err := worker.reserveFreeSlot(&request)
 
 		So(err, ShouldBeError)
-		So(err, ShouldEqual, job.ErrJobExpired)
+		So(errors.Is(err, job.ErrJobExpired), ShouldBeTrue)
+
+		var expiredErr *job.ExpiredError
+		So(errors.As(err, &expiredErr), ShouldBeTrue)
+		So(expiredErr.Wait, ShouldAlmostEqual, 20*time.Millisecond, 2*time.Millisecond)
+		So(expiredErr.Quotas, ShouldResemble, []config.Quota{*config.NewQuota(1, 20*time.Millisecond)})
 	})
 }
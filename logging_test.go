@@ -0,0 +1,65 @@
+package limiter
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/chatex-com/rate-limiter/pkg/config"
+)
+
+// syncBuffer is written by workers concurrently
+type syncBuffer struct {
+	buf bytes.Buffer
+	mu  sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
+
+func TestLogging(t *testing.T) {
+	Convey("Structured logs of the limiter", t, func() {
+		buf := &syncBuffer{}
+		cfg := config.NewConfigWithQuotas([]*config.Quota{
+			config.NewQuota(1, 50*time.Millisecond),
+		})
+		cfg.Concurrency = 1
+		cfg.Logger = slog.New(slog.NewTextHandler(buf, nil))
+		l, _ := NewRateLimiter(cfg)
+		l.Start()
+
+		noop := func() (interface{}, error) {
+			return nil, nil
+		}
+		<-l.Execute(noop)
+		// the job waits for the slot
+		<-l.Execute(noop)
+		<-l.ExecuteWithTimout(noop, 10*time.Millisecond)
+		l.Stop()
+
+		logs := buf.String()
+		So(logs, ShouldContainSubstring, `msg="rate limiter configured"`)
+		So(logs, ShouldContainSubstring, `msg="rate limiter started" component=rate_limiter workers=1`)
+		So(logs, ShouldContainSubstring, `msg="quota exhausted"`)
+		So(logs, ShouldContainSubstring, `level=WARN msg="job expired"`)
+		So(logs, ShouldContainSubstring, `msg="rate limiter stopped"`)
+		// debug records are disabled by the handler
+		So(strings.Contains(logs, "worker started"), ShouldBeFalse)
+	})
+}
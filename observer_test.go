@@ -0,0 +1,109 @@
+package limiter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/chatex-com/rate-limiter/pkg/config"
+	"github.com/chatex-com/rate-limiter/pkg/event"
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+func observe(ch <-chan event.Event, n int) []event.Event {
+	list := make([]event.Event, 0, n)
+	for i := 0; i < n; i++ {
+		select {
+		case e := <-ch:
+			list = append(list, e)
+		case <-time.After(time.Second):
+			return list
+		}
+	}
+
+	return list
+}
+
+func eventTypes(list []event.Event) []event.Type {
+	types := make([]event.Type, len(list))
+	for i, e := range list {
+		types[i] = e.Type
+	}
+
+	return types
+}
+
+func TestObserver(t *testing.T) {
+	Convey("Lifecycle events of jobs", t, func() {
+		observed := make(chan event.Event, 100)
+		cfg := config.NewConfigWithQuotas([]*config.Quota{
+			config.NewQuota(1, 50*time.Millisecond),
+		})
+		cfg.Concurrency = 1
+		cfg.Observer = event.ObserverFunc(func(e event.Event) {
+			observed <- e
+		})
+		l, _ := NewRateLimiter(cfg)
+		l.Start()
+
+		resp := <-l.ExecuteWithOptions(func() (interface{}, error) {
+			return "foo", nil
+		}, WithKey("foo"))
+		So(resp.Error, ShouldBeNil)
+
+		list := observe(observed, 4)
+		So(eventTypes(list), ShouldResemble, []event.Type{event.Enqueued, event.Dequeued, event.Started, event.Finished})
+		So(list[0].Key, ShouldEqual, "foo")
+
+		// the job waits for the slot released by the previous one
+		resp = <-l.Execute(func() (interface{}, error) {
+			panic("boom")
+		})
+		So(errors.Is(resp.Error, job.ErrJobPanicked), ShouldBeTrue)
+
+		list = observe(observed, 7)
+		So(eventTypes(list), ShouldResemble, []event.Type{
+			event.Enqueued, event.Dequeued, event.WaitStarted, event.WaitFinished,
+			event.Started, event.Panicked, event.Finished,
+		})
+		So(list[3].Wait, ShouldBeGreaterThan, 0)
+		So(list[5].Panic, ShouldEqual, "boom")
+
+		_, err := l.TryExecute(func() (interface{}, error) {
+			return nil, nil
+		}, WithWeight(2))
+		So(err, ShouldEqual, job.ErrWeightExceedsCapacity)
+
+		list = observe(observed, 1)
+		So(eventTypes(list), ShouldResemble, []event.Type{event.Rejected})
+		So(list[0].Err, ShouldEqual, job.ErrWeightExceedsCapacity)
+		So(l.Stat().EventsDropped, ShouldEqual, 0)
+	})
+
+	Convey("Panicking observer doesn't crash the limiter", t, func() {
+		cfg := config.NewConfig()
+		cfg.Observer = event.ObserverFunc(func(e event.Event) {
+			panic("boom")
+		})
+		l, _ := NewRateLimiter(cfg)
+		l.Start()
+
+		resp := <-l.Execute(func() (interface{}, error) {
+			return "foo", nil
+		})
+		So(resp.Result, ShouldEqual, "foo")
+
+		// events are observed asynchronously
+		for l.Stat().ObserverPanics == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		l.Close()
+
+		// the closed limiter can't be started again
+		l.Start()
+		So(l.isRunning, ShouldBeFalse)
+	})
+}
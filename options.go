@@ -0,0 +1,89 @@
+package limiter
+
+import (
+	"context"
+	"time"
+
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+// Option configures a single job execution
+type Option func(r *job.Request)
+
+// WithTimeout sets the duration after which the job is expired if it wasn't started
+func WithTimeout(timeout time.Duration) Option {
+	return func(r *job.Request) {
+		if timeout > 0 {
+			r.ExpiredAt = time.Now().Add(timeout)
+		}
+	}
+}
+
+// WithKey sets the key for quotas which are applied separately to every key
+// (see config.Config.AddKeyQuota)
+func WithKey(key string) Option {
+	return func(r *job.Request) {
+		r.Key = key
+	}
+}
+
+// WithPath sets the path in the quota hierarchy, e.g. account, endpoint and customer
+// (see config.Config.AddLevelQuota)
+func WithPath(path ...string) Option {
+	return func(r *job.Request) {
+		r.Path = path
+	}
+}
+
+// WithTenant sets the tenant for fair queuing of jobs (see config.Config.FairQueue)
+func WithTenant(tenant string) Option {
+	return func(r *job.Request) {
+		r.Tenant = tenant
+	}
+}
+
+// WithInterceptors adds interceptors which are run around the job
+// after interceptors of the limiter (see RateLimiter.Use)
+func WithInterceptors(interceptors ...job.Interceptor) Option {
+	return func(r *job.Request) {
+		r.Interceptors = append(r.Interceptors, interceptors...)
+	}
+}
+
+// WithContext sets the context of the job. The job is failed with the context
+// error if the context is done before the job is started.
+func WithContext(ctx context.Context) Option {
+	return func(r *job.Request) {
+		r.Ctx = ctx
+	}
+}
+
+// WithDedupKey shares the job between concurrent requests with the same key.
+// Only the first job is executed with its options and all callers receive the same
+// response. A subsequent request is failed if its deadline passes or its context
+// is done before the job is started; its other options (e.g. interceptors) are ignored.
+// If the first request gives up before the job is started, the job is handed over
+// to the next waiting request and executed with its options.
+func WithDedupKey(key string) Option {
+	return func(r *job.Request) {
+		r.DedupKey = key
+	}
+}
+
+// WithCache caches the successful response of the job by the key for ttl.
+// When quota is exhausted the expired response is served for staleTTL
+// and refreshed in background.
+func WithCache(key string, ttl, staleTTL time.Duration) Option {
+	return func(r *job.Request) {
+		r.CacheKey = key
+		r.CacheTTL = ttl
+		r.CacheStaleTTL = staleTTL
+	}
+}
+
+// WithWeight sets the number of slots taken by the job in every quota
+func WithWeight(weight uint) Option {
+	return func(r *job.Request) {
+		r.Weight = weight
+	}
+}
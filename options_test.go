@@ -0,0 +1,75 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+func TestOptions(t *testing.T) {
+	Convey("WithTimeout", t, func() {
+		r := job.Request{}
+		WithTimeout(time.Minute)(&r)
+
+		So(r.ExpiredAt, ShouldHappenWithin, time.Second, time.Now().Add(time.Minute))
+	})
+
+	Convey("WithTimeout zero value", t, func() {
+		r := job.Request{}
+		WithTimeout(0)(&r)
+
+		So(r.ExpiredAt.IsZero(), ShouldBeTrue)
+	})
+
+	Convey("WithKey", t, func() {
+		r := job.Request{}
+		WithKey("foo")(&r)
+
+		So(r.Key, ShouldEqual, "foo")
+	})
+
+	Convey("WithPath", t, func() {
+		r := job.Request{}
+		WithPath("account", "orders")(&r)
+
+		So(r.Path, ShouldResemble, []string{"account", "orders"})
+	})
+
+	Convey("WithCache", t, func() {
+		r := job.Request{}
+		WithCache("foo", time.Minute, time.Hour)(&r)
+
+		So(r.CacheKey, ShouldEqual, "foo")
+		So(r.CacheTTL, ShouldEqual, time.Minute)
+		So(r.CacheStaleTTL, ShouldEqual, time.Hour)
+	})
+
+	Convey("WithWeight", t, func() {
+		r := job.Request{}
+		WithWeight(5)(&r)
+
+		So(r.Weight, ShouldEqual, 5)
+	})
+
+	Convey("WithDedupKey", t, func() {
+		r := job.Request{}
+		WithDedupKey("foo")(&r)
+
+		So(r.DedupKey, ShouldEqual, "foo")
+	})
+}
+
+func TestWithContext(t *testing.T) {
+	Convey("WithContext", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		r := job.Request{}
+		WithContext(ctx)(&r)
+
+		So(r.Context(), ShouldEqual, ctx)
+	})
+}
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"time"
+)
+
+const (
+	defaultAdaptiveBackoff = 0.9
+)
+
+// Adaptive configures AIMD (additive increase, multiplicative decrease)
+// concurrency limit which is used instead of static Config.Concurrency
+type Adaptive struct {
+	MinConcurrency uint32
+	MaxConcurrency uint32
+	// LatencyThreshold is the job latency above which the limit is decreased.
+	// The limit is decreased at most once per this interval.
+	LatencyThreshold time.Duration
+	// Backoff is the multiplier applied to the limit on decrease, must be in (0, 1)
+	Backoff float64
+}
+
+func NewAdaptive(min, max uint32, latencyThreshold time.Duration) *Adaptive {
+	return &Adaptive{
+		MinConcurrency:   min,
+		MaxConcurrency:   max,
+		LatencyThreshold: latencyThreshold,
+		Backoff:          defaultAdaptiveBackoff,
+	}
+}
@@ -0,0 +1,19 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNewAdaptive(t *testing.T) {
+	Convey("Default backoff", t, func() {
+		cfg := NewAdaptive(1, 10, time.Second)
+
+		So(cfg.MinConcurrency, ShouldEqual, 1)
+		So(cfg.MaxConcurrency, ShouldEqual, 10)
+		So(cfg.LatencyThreshold, ShouldEqual, time.Second)
+		So(cfg.Backoff, ShouldEqual, defaultAdaptiveBackoff)
+	})
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"time"
+)
+
+const (
+	defaultHalfOpenProbes = 1
+)
+
+// CircuitBreaker configures failing of jobs without execution when the upstream is down.
+// The breaker is opened on ConsecutiveFailures in a row or when the ratio
+// of failed jobs within Window exceeds ErrorRatio. After OpenTimeout it lets
+// HalfOpenProbes jobs through and closes if all of them succeed.
+type CircuitBreaker struct {
+	// ConsecutiveFailures is the number of failures in a row to open the breaker, zero disables the condition
+	ConsecutiveFailures uint32
+	// ErrorRatio is the ratio of failed jobs to open the breaker, zero disables the condition
+	ErrorRatio float64
+	// MinRequests is the minimal number of jobs within Window to check ErrorRatio
+	MinRequests uint32
+	Window      time.Duration
+	OpenTimeout time.Duration
+	// HalfOpenProbes is the number of jobs executed in half-open state
+	HalfOpenProbes uint32
+}
+
+func NewCircuitBreaker(consecutiveFailures uint32, openTimeout time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		ConsecutiveFailures: consecutiveFailures,
+		OpenTimeout:         openTimeout,
+		HalfOpenProbes:      defaultHalfOpenProbes,
+	}
+}
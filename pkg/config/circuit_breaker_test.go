@@ -0,0 +1,19 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNewCircuitBreaker(t *testing.T) {
+	Convey("Defaults", t, func() {
+		cfg := NewCircuitBreaker(5, time.Second)
+
+		So(cfg.ConsecutiveFailures, ShouldEqual, 5)
+		So(cfg.OpenTimeout, ShouldEqual, time.Second)
+		So(cfg.HalfOpenProbes, ShouldEqual, defaultHalfOpenProbes)
+		So(cfg.ErrorRatio, ShouldBeZeroValue)
+	})
+}
@@ -1,23 +1,68 @@
 package config
 
 import (
+	"log/slog"
 	"sync"
+	"time"
+
+	"github.com/chatex-com/rate-limiter/pkg/event"
 )
 
 const (
-	defaultConcurrency = 100
+	defaultConcurrency    = 100
+	defaultObserverBuffer = 1024
+	defaultLogBurst       = 10
+	defaultLogInterval    = time.Second
 )
 
 type Config struct {
 	Concurrency uint32
+	// Adaptive enables concurrency limit adjusted by observed job latency
+	// and errors. Config.Concurrency is ignored if it's set.
+	Adaptive *Adaptive
+	// CircuitBreaker is applied to all jobs of the limiter and separately to jobs of every key
+	CircuitBreaker *CircuitBreaker
+	// FairQueue enables weighted fair queuing across tenants instead of FIFO
+	FairQueue *FairQueue
+	// EarliestDeadlineFirst enables dispatching of queued jobs ordered by ExpiredAt
+	// instead of FIFO, so fewer of them expire. It can't be used with FairQueue.
+	EarliestDeadlineFirst bool
+	// LoadShedding enables failing of jobs on submission and on leaving the queue
+	// if their earliest possible start exceeds the deadline
+	LoadShedding bool
+	// Observer receives lifecycle events of jobs. Events are delivered asynchronously
+	// and dropped if ObserverBuffer is full, so a slow observer can't stall workers.
+	Observer       event.Observer
+	ObserverBuffer int
+	// Logger receives structured logs of quota exhaustion, expirations, worker start/stop
+	// and configuration changes. Nothing is logged if it's not set.
+	Logger *slog.Logger
+	// LogSampling limits the number of records of high-frequency events
+	LogSampling LogSampling
+
+	quotas          []*Quota
+	keyQuotas       []*Quota
+	levelQuotas     [][]*Quota
+	shadowQuotas    []*Quota
+	shadowKeyQuotas []*Quota
+	quotasMu        sync.RWMutex
+}
 
-	quotas   []*Quota
-	quotasMu sync.RWMutex
+// LogSampling allows at most Burst records of the same event within Interval.
+// Sampling is disabled if Burst is zero.
+type LogSampling struct {
+	Burst    int
+	Interval time.Duration
 }
 
 func NewConfig() *Config {
 	return &Config{
-		Concurrency: defaultConcurrency,
+		Concurrency:    defaultConcurrency,
+		ObserverBuffer: defaultObserverBuffer,
+		LogSampling: LogSampling{
+			Burst:    defaultLogBurst,
+			Interval: defaultLogInterval,
+		},
 	}
 }
 
@@ -49,3 +94,94 @@ func (c *Config) GetQuotas() []Quota {
 
 	return quotas
 }
+
+// AddKeyQuota adds quota which is applied separately to every key
+// passed with the request (e.g. user ID or API endpoint)
+func (c *Config) AddKeyQuota(quota *Quota) {
+	c.quotasMu.Lock()
+	defer c.quotasMu.Unlock()
+
+	c.keyQuotas = append(c.keyQuotas, quota)
+}
+
+func (c *Config) GetKeyQuotas() []Quota {
+	c.quotasMu.Lock()
+	defer c.quotasMu.Unlock()
+
+	quotas := make([]Quota, len(c.keyQuotas))
+	for i, q := range c.keyQuotas {
+		quotas[i] = *q
+	}
+
+	return quotas
+}
+
+// AddLevelQuota adds quota of the level of the quota hierarchy. It's applied separately
+// to every path prefix of level+1 elements passed with the request, e.g. level 0 is
+// an account, level 1 is an endpoint of the account and level 2 is a customer.
+func (c *Config) AddLevelQuota(level uint, quota *Quota) {
+	c.quotasMu.Lock()
+	defer c.quotasMu.Unlock()
+
+	for uint(len(c.levelQuotas)) <= level {
+		c.levelQuotas = append(c.levelQuotas, nil)
+	}
+
+	c.levelQuotas[level] = append(c.levelQuotas[level], quota)
+}
+
+func (c *Config) GetLevelQuotas() [][]Quota {
+	c.quotasMu.Lock()
+	defer c.quotasMu.Unlock()
+
+	levels := make([][]Quota, len(c.levelQuotas))
+	for i, level := range c.levelQuotas {
+		levels[i] = make([]Quota, len(level))
+		for j, q := range level {
+			levels[i][j] = *q
+		}
+	}
+
+	return levels
+}
+
+// AddShadowQuota adds quota which is evaluated for every job but never delays it.
+// Would-be delays and expirations are reported by the limiter stat.
+func (c *Config) AddShadowQuota(quota *Quota) {
+	c.quotasMu.Lock()
+	defer c.quotasMu.Unlock()
+
+	c.shadowQuotas = append(c.shadowQuotas, quota)
+}
+
+func (c *Config) GetShadowQuotas() []Quota {
+	c.quotasMu.Lock()
+	defer c.quotasMu.Unlock()
+
+	quotas := make([]Quota, len(c.shadowQuotas))
+	for i, q := range c.shadowQuotas {
+		quotas[i] = *q
+	}
+
+	return quotas
+}
+
+// AddShadowKeyQuota adds shadow quota which is evaluated separately for every key
+func (c *Config) AddShadowKeyQuota(quota *Quota) {
+	c.quotasMu.Lock()
+	defer c.quotasMu.Unlock()
+
+	c.shadowKeyQuotas = append(c.shadowKeyQuotas, quota)
+}
+
+func (c *Config) GetShadowKeyQuotas() []Quota {
+	c.quotasMu.Lock()
+	defer c.quotasMu.Unlock()
+
+	quotas := make([]Quota, len(c.shadowKeyQuotas))
+	for i, q := range c.shadowKeyQuotas {
+		quotas[i] = *q
+	}
+
+	return quotas
+}
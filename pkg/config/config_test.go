@@ -2,6 +2,7 @@ package config
 
 import (
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -35,3 +36,55 @@ func TestNewConfigWithQuotas(t *testing.T) {
 		So(cfg.quotas, ShouldHaveLength, 2)
 	})
 }
+
+func TestKeyQuotas(t *testing.T) {
+	Convey("Add key quota", t, func() {
+		cfg := NewConfig()
+		cfg.AddQuota(NewQuota(10, time.Second))
+		cfg.AddKeyQuota(NewConcurrencyQuota(2))
+
+		So(cfg.GetQuotas(), ShouldHaveLength, 1)
+		So(cfg.GetKeyQuotas(), ShouldHaveLength, 1)
+		So(cfg.GetKeyQuotas()[0].Type, ShouldEqual, QuotaTypeConcurrency)
+	})
+}
+
+func TestLevelQuotas(t *testing.T) {
+	Convey("Add level quota", t, func() {
+		cfg := NewConfig()
+		So(cfg.GetLevelQuotas(), ShouldBeEmpty)
+
+		cfg.AddLevelQuota(0, NewQuota(10, time.Second))
+		cfg.AddLevelQuota(2, NewQuota(1, time.Second))
+		cfg.AddLevelQuota(2, NewConcurrencyQuota(1))
+
+		levels := cfg.GetLevelQuotas()
+		So(levels, ShouldHaveLength, 3)
+		So(levels[0], ShouldHaveLength, 1)
+		So(levels[1], ShouldBeEmpty)
+		So(levels[2], ShouldHaveLength, 2)
+		So(levels[2][1].Type, ShouldEqual, QuotaTypeConcurrency)
+	})
+}
+
+func TestShadowQuotas(t *testing.T) {
+	Convey("Add shadow quotas", t, func() {
+		cfg := NewConfig()
+		cfg.AddShadowQuota(NewQuota(10, time.Second))
+		cfg.AddShadowKeyQuota(NewQuota(1, time.Second))
+		cfg.AddShadowKeyQuota(NewConcurrencyQuota(2))
+
+		So(cfg.GetQuotas(), ShouldBeEmpty)
+		So(cfg.GetShadowQuotas(), ShouldHaveLength, 1)
+		So(cfg.GetShadowKeyQuotas(), ShouldHaveLength, 2)
+	})
+}
+
+func TestLogSampling(t *testing.T) {
+	Convey("Default log sampling", t, func() {
+		cfg := NewConfig()
+
+		So(cfg.Logger, ShouldBeNil)
+		So(cfg.LogSampling, ShouldResemble, LogSampling{Burst: 10, Interval: time.Second})
+	})
+}
@@ -0,0 +1,29 @@
+package config
+
+const (
+	defaultTenantWeight = 1
+)
+
+// FairQueue configures weighted fair queuing of jobs across tenants instead of FIFO.
+// Queued jobs are dispatched in deficit round robin order: every round a tenant
+// can dispatch jobs taking up to its weight of quota slots.
+type FairQueue struct {
+	// Weights of tenants, a tenant with weight 2 gets twice more slots than a tenant with weight 1
+	Weights map[string]uint
+	// DefaultWeight is the weight of tenants missing in Weights
+	DefaultWeight uint
+}
+
+func NewFairQueue() *FairQueue {
+	return &FairQueue{
+		Weights:       make(map[string]uint),
+		DefaultWeight: defaultTenantWeight,
+	}
+}
+
+// SetWeight sets the weight of the tenant
+func (q *FairQueue) SetWeight(tenant string, weight uint) *FairQueue {
+	q.Weights[tenant] = weight
+
+	return q
+}
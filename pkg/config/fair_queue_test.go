@@ -0,0 +1,16 @@
+package config
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNewFairQueue(t *testing.T) {
+	Convey("Default weights", t, func() {
+		q := NewFairQueue().SetWeight("foo", 3)
+
+		So(q.DefaultWeight, ShouldEqual, 1)
+		So(q.Weights, ShouldResemble, map[string]uint{"foo": 3})
+	})
+}
@@ -4,14 +4,81 @@ import (
 	"time"
 )
 
+type QuotaType uint8
+
+const (
+	// QuotaTypeWindow limits the number of requests per time interval
+	QuotaTypeWindow QuotaType = iota
+	// QuotaTypeConcurrency limits the number of simultaneously executing requests
+	QuotaTypeConcurrency
+)
+
 type Quota struct {
+	Type     QuotaType
 	Capacity uint
 	Interval time.Duration
+	// Schedules override the capacity within their time windows.
+	// The first schedule containing the time is applied.
+	Schedules []Schedule
 }
 
 func NewQuota(capacity uint, interval time.Duration) *Quota {
 	return &Quota{
+		Type:     QuotaTypeWindow,
 		Capacity: capacity,
 		Interval: interval,
 	}
 }
+
+// NewConcurrencyQuota creates quota which holds a slot from the job start
+// till the job completion. Interval is not used for this type of quota.
+func NewConcurrencyQuota(capacity uint) *Quota {
+	return &Quota{
+		Type:     QuotaTypeConcurrency,
+		Capacity: capacity,
+	}
+}
+
+// AddSchedule overrides the capacity within the time window of the schedule
+func (q *Quota) AddSchedule(s *Schedule) *Quota {
+	q.Schedules = append(q.Schedules, *s)
+
+	return q
+}
+
+// CapacityAt returns the capacity effective at the time
+func (q *Quota) CapacityAt(t time.Time) uint {
+	for i := range q.Schedules {
+		if q.Schedules[i].Contains(t) {
+			return q.Schedules[i].Capacity
+		}
+	}
+
+	return q.Capacity
+}
+
+// MaxCapacity returns the max capacity of the quota and its schedules
+func (q *Quota) MaxCapacity() uint {
+	capacity := q.Capacity
+	for _, s := range q.Schedules {
+		if s.Capacity > capacity {
+			capacity = s.Capacity
+		}
+	}
+
+	return capacity
+}
+
+// NextChange returns the closest time after the given one when the capacity
+// can be changed by schedules. It returns zero time if there are no schedules.
+func (q *Quota) NextChange(t time.Time) time.Time {
+	var next time.Time
+	for i := range q.Schedules {
+		change := q.Schedules[i].NextChange(t)
+		if !change.IsZero() && (next.IsZero() || change.Before(next)) {
+			next = change
+		}
+	}
+
+	return next
+}
@@ -15,3 +15,13 @@ func TestNewQuota(t *testing.T) {
 		So(rule.Interval, ShouldEqual, time.Second)
 	})
 }
+
+func TestNewConcurrencyQuota(t *testing.T) {
+	Convey("Concurrency quota", t, func() {
+		rule := NewConcurrencyQuota(5)
+
+		So(rule.Type, ShouldEqual, QuotaTypeConcurrency)
+		So(rule.Capacity, ShouldEqual, 5)
+		So(rule.Interval, ShouldBeZeroValue)
+	})
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"time"
+)
+
+// Schedule overrides the capacity of the quota within the daily time window
+type Schedule struct {
+	Capacity uint
+	// From and To are offsets from the midnight. The window ends
+	// on the next day if To is not after From (e.g. 22:00 - 06:00).
+	From time.Duration
+	To   time.Duration
+	// Weekdays when the window starts. It starts every day if empty.
+	Weekdays []time.Weekday
+	// Location of the time window, UTC is used if it's nil
+	Location *time.Location
+}
+
+func NewSchedule(capacity uint, from, to time.Duration) *Schedule {
+	return &Schedule{
+		Capacity: capacity,
+		From:     from,
+		To:       to,
+	}
+}
+
+// Contains checks if the time is within the window
+func (s *Schedule) Contains(t time.Time) bool {
+	// the window started yesterday can last till today
+	for d := -1; d <= 0; d++ {
+		start, end, ok := s.window(t, d)
+		if ok && !t.Before(start) && t.Before(end) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NextChange returns the closest start or end of the window after the time
+func (s *Schedule) NextChange(t time.Time) time.Time {
+	var next time.Time
+
+	// the window must start at least once a week
+	for d := -1; d <= 7; d++ {
+		start, end, ok := s.window(t, d)
+		if !ok {
+			continue
+		}
+
+		for _, change := range []time.Time{start, end} {
+			if change.After(t) && (next.IsZero() || change.Before(next)) {
+				next = change
+			}
+		}
+	}
+
+	return next
+}
+
+// window returns the window which starts in d days after the day of the time
+func (s *Schedule) window(t time.Time, d int) (time.Time, time.Time, bool) {
+	loc := s.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	y, m, dd := t.In(loc).Date()
+	if !s.isWeekday(time.Date(y, m, dd+d, 0, 0, 0, 0, loc).Weekday()) {
+		return time.Time{}, time.Time{}, false
+	}
+
+	// the window is built of wall clock times, so days of DST changes aren't 24 hours long
+	endDay := dd + d
+	if s.To <= s.From {
+		endDay++
+	}
+
+	return wallClock(y, m, dd+d, s.From, loc), wallClock(y, m, endDay, s.To, loc), true
+}
+
+// wallClock returns the time of the day with the offset from the midnight read as a wall clock time
+func wallClock(y int, m time.Month, d int, offset time.Duration, loc *time.Location) time.Time {
+	return time.Date(y, m, d, 0, 0, int(offset/time.Second), int(offset%time.Second), loc)
+}
+
+func (s *Schedule) isWeekday(weekday time.Weekday) bool {
+	if len(s.Weekdays) == 0 {
+		return true
+	}
+
+	for _, w := range s.Weekdays {
+		if w == weekday {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSchedule(t *testing.T) {
+	Convey("Daily window", t, func() {
+		s := NewSchedule(10, 9*time.Hour, 18*time.Hour)
+
+		So(s.Contains(time.Date(2020, 1, 1, 8, 59, 0, 0, time.UTC)), ShouldBeFalse)
+		So(s.Contains(time.Date(2020, 1, 1, 9, 0, 0, 0, time.UTC)), ShouldBeTrue)
+		So(s.Contains(time.Date(2020, 1, 1, 18, 0, 0, 0, time.UTC)), ShouldBeFalse)
+
+		So(s.NextChange(time.Date(2020, 1, 1, 8, 0, 0, 0, time.UTC)), ShouldEqual, time.Date(2020, 1, 1, 9, 0, 0, 0, time.UTC))
+		So(s.NextChange(time.Date(2020, 1, 1, 9, 0, 0, 0, time.UTC)), ShouldEqual, time.Date(2020, 1, 1, 18, 0, 0, 0, time.UTC))
+		So(s.NextChange(time.Date(2020, 1, 1, 19, 0, 0, 0, time.UTC)), ShouldEqual, time.Date(2020, 1, 2, 9, 0, 0, 0, time.UTC))
+	})
+
+	Convey("Overnight window on weekdays in the location", t, func() {
+		loc := time.FixedZone("UTC+3", 3*60*60)
+		s := NewSchedule(10, 22*time.Hour, 6*time.Hour)
+		s.Weekdays = []time.Weekday{time.Friday}
+		s.Location = loc
+
+		// Friday, January 3rd, 2020
+		So(s.Contains(time.Date(2020, 1, 3, 21, 0, 0, 0, loc)), ShouldBeFalse)
+		So(s.Contains(time.Date(2020, 1, 3, 22, 0, 0, 0, loc)), ShouldBeTrue)
+		So(s.Contains(time.Date(2020, 1, 3, 20, 0, 0, 0, time.UTC)), ShouldBeTrue)
+		So(s.Contains(time.Date(2020, 1, 4, 5, 0, 0, 0, loc)), ShouldBeTrue)
+		So(s.Contains(time.Date(2020, 1, 4, 22, 0, 0, 0, loc)), ShouldBeFalse)
+
+		So(s.NextChange(time.Date(2020, 1, 4, 7, 0, 0, 0, loc)).Equal(time.Date(2020, 1, 10, 22, 0, 0, 0, loc)), ShouldBeTrue)
+	})
+
+	Convey("Window on the day of DST change", t, func() {
+		loc, err := time.LoadLocation("America/New_York")
+		So(err, ShouldBeNil)
+		s := NewSchedule(10, 9*time.Hour, 17*time.Hour)
+		s.Location = loc
+
+		// clocks are turned forward at 2:00 on Sunday, March 8th, 2026
+		So(s.Contains(time.Date(2026, 3, 8, 8, 59, 0, 0, loc)), ShouldBeFalse)
+		So(s.Contains(time.Date(2026, 3, 8, 9, 0, 0, 0, loc)), ShouldBeTrue)
+		So(s.Contains(time.Date(2026, 3, 8, 16, 59, 0, 0, loc)), ShouldBeTrue)
+		So(s.Contains(time.Date(2026, 3, 8, 17, 0, 0, 0, loc)), ShouldBeFalse)
+
+		So(s.NextChange(time.Date(2026, 3, 8, 1, 0, 0, 0, loc)).Equal(time.Date(2026, 3, 8, 9, 0, 0, 0, loc)), ShouldBeTrue)
+
+		overnight := NewSchedule(10, 22*time.Hour, 6*time.Hour)
+		overnight.Location = loc
+		So(overnight.Contains(time.Date(2026, 3, 8, 5, 59, 0, 0, loc)), ShouldBeTrue)
+		So(overnight.Contains(time.Date(2026, 3, 8, 6, 0, 0, 0, loc)), ShouldBeFalse)
+	})
+}
+
+func TestQuotaSchedules(t *testing.T) {
+	Convey("Capacity is overridden by the first matching schedule", t, func() {
+		q := NewQuota(10, time.Second).
+			AddSchedule(NewSchedule(5, 9*time.Hour, 18*time.Hour)).
+			AddSchedule(NewSchedule(20, 0, 12*time.Hour))
+
+		So(q.CapacityAt(time.Date(2020, 1, 1, 8, 0, 0, 0, time.UTC)), ShouldEqual, 20)
+		So(q.CapacityAt(time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)), ShouldEqual, 5)
+		So(q.CapacityAt(time.Date(2020, 1, 1, 20, 0, 0, 0, time.UTC)), ShouldEqual, 10)
+		So(q.MaxCapacity(), ShouldEqual, 20)
+
+		So(q.NextChange(time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)), ShouldEqual, time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+		So(NewQuota(10, time.Second).NextChange(time.Now()), ShouldBeZeroValue)
+	})
+}
@@ -0,0 +1,76 @@
+package event
+
+import (
+	"time"
+)
+
+type Type uint8
+
+const (
+	// Enqueued is emitted when the job is put into the queue
+	Enqueued Type = iota
+	// Dequeued is emitted when the job is passed to a worker
+	Dequeued
+	// WaitStarted is emitted when the job starts waiting for a free slot
+	WaitStarted
+	// WaitFinished is emitted when the job stops waiting for a free slot, Wait is set
+	WaitFinished
+	// Started is emitted right before the job execution
+	Started
+	// Finished is emitted after the job execution, Latency and Err are set
+	Finished
+	// Expired is emitted when the job is expired in the queue or on waiting for a free slot
+	Expired
+	// Rejected is emitted when the job is failed without execution (e.g. circuit breaker is open)
+	Rejected
+	// Panicked is emitted when the job panics, Panic is set
+	Panicked
+)
+
+var typeNames = map[Type]string{
+	Enqueued:     "enqueued",
+	Dequeued:     "dequeued",
+	WaitStarted:  "wait_started",
+	WaitFinished: "wait_finished",
+	Started:      "started",
+	Finished:     "finished",
+	Expired:      "expired",
+	Rejected:     "rejected",
+	Panicked:     "panicked",
+}
+
+func (t Type) String() string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+
+	return "unknown"
+}
+
+// Event is a lifecycle event of a job
+type Event struct {
+	Type   Type
+	Time   time.Time
+	Key    string
+	Tenant string
+	// Wait is the duration of waiting for a free slot
+	Wait time.Duration
+	// Latency is the duration of the job execution
+	Latency time.Duration
+	Err     error
+	// Panic is the value recovered from the panic of the job
+	Panic interface{}
+}
+
+// Observer receives lifecycle events of jobs. Events are delivered
+// asynchronously one by one in the order they were emitted.
+type Observer interface {
+	Observe(e Event)
+}
+
+// ObserverFunc is an adapter to use a function as Observer
+type ObserverFunc func(e Event)
+
+func (f ObserverFunc) Observe(e Event) {
+	f(e)
+}
@@ -0,0 +1,27 @@
+package event
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestType(t *testing.T) {
+	Convey("Type names", t, func() {
+		So(Enqueued.String(), ShouldEqual, "enqueued")
+		So(Panicked.String(), ShouldEqual, "panicked")
+		So(Type(100).String(), ShouldEqual, "unknown")
+	})
+}
+
+func TestObserverFunc(t *testing.T) {
+	Convey("Function as observer", t, func() {
+		var observed Event
+		var o Observer = ObserverFunc(func(e Event) {
+			observed = e
+		})
+
+		o.Observe(Event{Type: Started, Key: "foo"})
+		So(observed, ShouldResemble, Event{Type: Started, Key: "foo"})
+	})
+}
@@ -0,0 +1,101 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/chatex-com/rate-limiter/pkg/config"
+)
+
+// ErrRateLimited is returned when a job can't be executed immediately because of quotas
+var ErrRateLimited = errors.New("rate limited")
+
+// ErrWeightExceedsCapacity is returned when the job weight exceeds the capacity of a quota
+var ErrWeightExceedsCapacity = errors.New("job weight exceeds quota capacity")
+
+// ErrBookingCanceled is returned for a job scheduled on a booking which was canceled
+var ErrBookingCanceled = errors.New("booking was canceled")
+
+// ErrBookingUsed is returned when a booking is used for more than one job
+var ErrBookingUsed = errors.New("booking was already used")
+
+// RateLimitError reports exhausted quotas and the duration to wait for a free slot.
+// The wait is zero if it can't be predicted (only concurrency quotas are exhausted)
+// or no worker is free to start the job immediately (see RateLimiter.TryExecute).
+// It wraps ErrRateLimited.
+type RateLimitError struct {
+	Wait   time.Duration
+	Quotas []config.Quota
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s by %d quota(s): retry after %s", ErrRateLimited, len(e.Quotas), e.Wait)
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// ExpiredError reports why the job was expired. It wraps ErrJobExpired.
+type ExpiredError struct {
+	// QueuePosition is the position of the request in the queue at expiry.
+	// It's zero if the request was already taken by a worker.
+	QueuePosition int
+	// Wait is the duration to wait for a free slot if the job was expired on waiting
+	Wait time.Duration
+	// Quotas are exhausted quotas if the job was expired on waiting for a free slot
+	Quotas []config.Quota
+}
+
+func (e *ExpiredError) Error() string {
+	if e.QueuePosition > 0 {
+		return fmt.Sprintf("%s at queue position %d", ErrJobExpired, e.QueuePosition)
+	}
+
+	if len(e.Quotas) > 0 {
+		return fmt.Sprintf("%s on waiting %s for %d quota(s)", ErrJobExpired, e.Wait, len(e.Quotas))
+	}
+
+	return ErrJobExpired.Error()
+}
+
+func (e *ExpiredError) Unwrap() error {
+	return ErrJobExpired
+}
+
+// ErrJobPanicked is returned when the job panics
+var ErrJobPanicked = errors.New("job panicked")
+
+// PanicError reports the value recovered from the panic of the job and the stack trace.
+// It wraps ErrJobPanicked.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%s: %v", ErrJobPanicked, e.Value)
+}
+
+func (e *PanicError) Unwrap() error {
+	return ErrJobPanicked
+}
+
+// ErrWouldExpire is returned when the job can't be started before its deadline
+var ErrWouldExpire = errors.New("job would expire before it's started")
+
+// WouldExpireError reports the estimated wait of the job which exceeds its deadline.
+// It wraps ErrWouldExpire.
+type WouldExpireError struct {
+	Wait     time.Duration
+	Deadline time.Time
+}
+
+func (e *WouldExpireError) Error() string {
+	return fmt.Sprintf("%s: estimated wait %s exceeds deadline", ErrWouldExpire, e.Wait)
+}
+
+func (e *WouldExpireError) Unwrap() error {
+	return ErrWouldExpire
+}
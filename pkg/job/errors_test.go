@@ -0,0 +1,77 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/chatex-com/rate-limiter/pkg/config"
+)
+
+func TestRateLimitError(t *testing.T) {
+	Convey("Wrapped sentinel and wait duration", t, func() {
+		var err error = &RateLimitError{
+			Wait:   time.Second,
+			Quotas: []config.Quota{*config.NewQuota(1, time.Second)},
+		}
+		err = fmt.Errorf("request: %w", err)
+
+		var rateLimitErr *RateLimitError
+		So(errors.Is(err, ErrRateLimited), ShouldBeTrue)
+		So(errors.As(err, &rateLimitErr), ShouldBeTrue)
+		So(rateLimitErr.Wait, ShouldEqual, time.Second)
+		So(rateLimitErr.Quotas, ShouldHaveLength, 1)
+		So(err.Error(), ShouldEqual, "request: rate limited by 1 quota(s): retry after 1s")
+	})
+}
+
+func TestExpiredError(t *testing.T) {
+	Convey("Expired in the queue", t, func() {
+		var err error = &ExpiredError{QueuePosition: 3}
+
+		So(errors.Is(err, ErrJobExpired), ShouldBeTrue)
+		So(err.Error(), ShouldEqual, "job was expired at queue position 3")
+	})
+
+	Convey("Expired on waiting for a free slot", t, func() {
+		var err error = &ExpiredError{
+			Wait:   time.Second,
+			Quotas: []config.Quota{*config.NewQuota(1, time.Second)},
+		}
+
+		var expiredErr *ExpiredError
+		So(errors.As(err, &expiredErr), ShouldBeTrue)
+		So(expiredErr.Wait, ShouldEqual, time.Second)
+		So(err.Error(), ShouldEqual, "job was expired on waiting 1s for 1 quota(s)")
+	})
+
+	Convey("Expired before execution", t, func() {
+		var err error = &ExpiredError{}
+
+		So(err.Error(), ShouldEqual, ErrJobExpired.Error())
+	})
+}
+
+func TestWouldExpireError(t *testing.T) {
+	Convey("Wrapped sentinel and estimated wait", t, func() {
+		var err error = &WouldExpireError{Wait: time.Minute, Deadline: time.Now()}
+
+		var wouldExpireErr *WouldExpireError
+		So(errors.Is(err, ErrWouldExpire), ShouldBeTrue)
+		So(errors.As(err, &wouldExpireErr), ShouldBeTrue)
+		So(wouldExpireErr.Wait, ShouldEqual, time.Minute)
+		So(err.Error(), ShouldEqual, "job would expire before it's started: estimated wait 1m0s exceeds deadline")
+	})
+}
+
+func TestPanicError(t *testing.T) {
+	Convey("Wrapped sentinel and recovered value", t, func() {
+		var err error = &PanicError{Value: "boom"}
+
+		So(errors.Is(err, ErrJobPanicked), ShouldBeTrue)
+		So(err.Error(), ShouldEqual, "job panicked: boom")
+	})
+}
@@ -1,13 +1,41 @@
 package job
 
 import (
+	"context"
 	"errors"
 )
 
 var ErrJobExpired = errors.New("job was expired")
 
+// ErrCircuitOpen is returned without execution of the job when the circuit breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// ErrNotCounted should be wrapped into the job error when the job failed
+// before reaching the upstream (e.g. validation or DNS error).
+// The quota slot reserved for such job is returned back.
+//
+//	return nil, fmt.Errorf("invalid symbol %q: %w", symbol, job.ErrNotCounted)
+var ErrNotCounted = errors.New("job was not counted")
+
 type Job func() (interface{}, error)
 
+// ContextJob is a job which receives the context of the request
+type ContextJob func(ctx context.Context) (interface{}, error)
+
+// Interceptor wraps the execution of a job, e.g. for metrics, logging or error mapping.
+// It must call next to execute the job.
+//
+//	func(next job.ContextJob) job.ContextJob {
+//		return func(ctx context.Context) (interface{}, error) {
+//			start := time.Now()
+//			result, err := next(ctx)
+//			latency.Observe(time.Since(start).Seconds())
+//
+//			return result, err
+//		}
+//	}
+type Interceptor func(next ContextJob) ContextJob
+
 type Response struct {
 	Result interface{}
 	Error  error
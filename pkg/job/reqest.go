@@ -1,13 +1,88 @@
 package job
 
 import (
+	"context"
 	"time"
 )
 
+// Reservation is a quota slot reserved for the request
+type Reservation interface {
+	// Refund returns the slot back to time window quotas
+	Refund()
+	// Release frees the slot of concurrency quotas
+	Release()
+}
+
 type Request struct {
-	Job       Job
-	Ch        chan Response
-	ExpiredAt time.Time
+	Job Job
+	// ContextJob is executed with Ctx instead of Job if it's set
+	ContextJob ContextJob
+	Ctx        context.Context
+	Ch         chan Response
+	ExpiredAt  time.Time
+	// Key is used for quotas applied separately to every key
+	Key string
+	// Path is used for hierarchical quotas, the element i is the node of the level i
+	Path []string
+	// Tenant is used for fair queuing of requests across tenants
+	Tenant string
+	// Weight is the number of slots taken in every quota, zero means one slot
+	Weight uint
+	// DedupKey is used to share the job between concurrent requests
+	DedupKey string
+	// CacheKey is used to cache the successful response for CacheTTL.
+	// The response is served as stale one for CacheStaleTTL if quota is exhausted.
+	CacheKey      string
+	CacheTTL      time.Duration
+	CacheStaleTTL time.Duration
+	// Interceptors are run around the job in order, the first one is the outermost
+	Interceptors []Interceptor
+	// Reservation is set if the slot was reserved before the request is passed
+	// to a worker (see RateLimiter.TryExecute)
+	Reservation Reservation
+}
+
+// Context returns the request context or background context if it's not set
+func (r Request) Context() context.Context {
+	if r.Ctx == nil {
+		return context.Background()
+	}
+
+	return r.Ctx
+}
+
+// Slots returns the number of slots taken by the request in every quota
+func (r Request) Slots() uint {
+	if r.Weight == 0 {
+		return 1
+	}
+
+	return r.Weight
+}
+
+// Run executes the job of the request wrapped by interceptors
+func (r Request) Run() (interface{}, error) {
+	if len(r.Interceptors) == 0 {
+		if r.ContextJob != nil {
+			return r.ContextJob(r.Context())
+		}
+
+		return r.Job()
+	}
+
+	run := r.ContextJob
+	if run == nil {
+		j := r.Job
+		run = func(ctx context.Context) (interface{}, error) {
+			return j()
+		}
+	}
+
+	for i := len(r.Interceptors) - 1; i >= 0; i-- {
+		run = r.Interceptors[i](run)
+	}
+
+	return run(r.Context())
 }
 
 func (r Request) IsExpired() bool {
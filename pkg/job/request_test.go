@@ -1,6 +1,7 @@
 package job
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -32,3 +33,104 @@ func TestIsExpired(t *testing.T) {
 		So(r.IsExpired(), ShouldBeFalse)
 	})
 }
+
+func TestContext(t *testing.T) {
+	Convey("Background context by default", t, func() {
+		r := Request{}
+
+		So(r.Context(), ShouldResemble, context.Background())
+	})
+
+	Convey("Request context", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		r := Request{Ctx: ctx}
+
+		So(r.Context(), ShouldEqual, ctx)
+	})
+}
+
+func TestRun(t *testing.T) {
+	Convey("Run job", t, func() {
+		r := Request{
+			Job: func() (interface{}, error) {
+				return "job", nil
+			},
+		}
+
+		result, err := r.Run()
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "job")
+	})
+
+	Convey("Run context job", t, func() {
+		type key struct{}
+		r := Request{
+			Ctx: context.WithValue(context.Background(), key{}, "ctx"),
+			ContextJob: func(ctx context.Context) (interface{}, error) {
+				return ctx.Value(key{}), nil
+			},
+		}
+
+		result, err := r.Run()
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "ctx")
+	})
+}
+
+func TestInterceptors(t *testing.T) {
+	Convey("Interceptors are run around the job in order", t, func() {
+		var calls []string
+		trace := func(name string) Interceptor {
+			return func(next ContextJob) ContextJob {
+				return func(ctx context.Context) (interface{}, error) {
+					calls = append(calls, name+" before")
+					result, err := next(ctx)
+					calls = append(calls, name+" after")
+
+					return result, err
+				}
+			}
+		}
+
+		r := Request{
+			Job: func() (interface{}, error) {
+				calls = append(calls, "job")
+				return "job", nil
+			},
+			Interceptors: []Interceptor{trace("first"), trace("second")},
+		}
+
+		result, err := r.Run()
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "job")
+		So(calls, ShouldResemble, []string{"first before", "second before", "job", "second after", "first after"})
+	})
+
+	Convey("Interceptor passes the context to the job", t, func() {
+		type key struct{}
+		r := Request{
+			ContextJob: func(ctx context.Context) (interface{}, error) {
+				return ctx.Value(key{}), nil
+			},
+			Interceptors: []Interceptor{
+				func(next ContextJob) ContextJob {
+					return func(ctx context.Context) (interface{}, error) {
+						return next(context.WithValue(ctx, key{}, "intercepted"))
+					}
+				},
+			},
+		}
+
+		result, err := r.Run()
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "intercepted")
+	})
+}
+
+func TestSlots(t *testing.T) {
+	Convey("One slot by default", t, func() {
+		So(Request{}.Slots(), ShouldEqual, 1)
+		So(Request{Weight: 5}.Slots(), ShouldEqual, 5)
+	})
+}
@@ -1,22 +1,56 @@
 package limiter
 
 import (
+	"context"
+	"errors"
+	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/chatex-com/rate-limiter/internal/adaptive"
+	"github.com/chatex-com/rate-limiter/internal/breaker"
+	"github.com/chatex-com/rate-limiter/internal/cache"
+	"github.com/chatex-com/rate-limiter/internal/events"
 	"github.com/chatex-com/rate-limiter/internal/limiter"
+	"github.com/chatex-com/rate-limiter/internal/logging"
+	"github.com/chatex-com/rate-limiter/internal/queue"
 	"github.com/chatex-com/rate-limiter/internal/worker"
 	"github.com/chatex-com/rate-limiter/pkg/config"
+	"github.com/chatex-com/rate-limiter/pkg/event"
 	"github.com/chatex-com/rate-limiter/pkg/job"
 )
 
+// ErrConflictingQueues is returned when both fair queuing and earliest deadline first are enabled
+var ErrConflictingQueues = errors.New("fair queue and earliest deadline first can't be used together")
+
 type RateLimiter struct {
 	quotas        *limiter.QuotaGroup
+	adaptive      *adaptive.Limiter
+	breakers      *breaker.Group
+	shadow        *limiter.Shadow
+	events        *events.Emitter
+	logger        *logging.Logger
+	interceptors  []job.Interceptor
+	interceptLock sync.RWMutex
 	workers       []*worker.Worker
+	queue         queue.Scheduler
 	requests      chan job.Request
+	// ready holds a token for every worker which is free
+	ready         chan struct{}
+	stop          chan struct{}
 	isRunning     bool
+	isPaused      bool
+	isClosed      bool
+	loadShedding  bool
 	isRunningLock sync.Locker
 	wg            sync.WaitGroup
+	flights       *flights
+	cache         *cache.Cache
+	rejected      int64
+	deduplicated  int64
+	expired       int64
+	shedCount     int64
 }
 
 func NewRateLimiter(cfg *config.Config) (*RateLimiter, error) {
@@ -25,57 +59,337 @@ func NewRateLimiter(cfg *config.Config) (*RateLimiter, error) {
 		return nil, err
 	}
 
+	err = quotas.SetKeyQuotas(cfg.GetKeyQuotas())
+	if err != nil {
+		return nil, err
+	}
+
+	err = quotas.SetLevelQuotas(cfg.GetLevelQuotas())
+	if err != nil {
+		return nil, err
+	}
+
+	concurrency := cfg.Concurrency
+
+	var adaptiveLimiter *adaptive.Limiter
+	if cfg.Adaptive != nil {
+		adaptiveLimiter, err = adaptive.NewLimiter(*cfg.Adaptive)
+		if err != nil {
+			return nil, err
+		}
+
+		// the number of jobs in flight is limited by the adaptive limiter
+		concurrency = cfg.Adaptive.MaxConcurrency
+	}
+
+	var breakers *breaker.Group
+	if cfg.CircuitBreaker != nil {
+		breakers, err = breaker.NewGroup(*cfg.CircuitBreaker)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var shadow *limiter.Shadow
+	if len(cfg.GetShadowQuotas()) > 0 || len(cfg.GetShadowKeyQuotas()) > 0 {
+		shadowQuotas, err := limiter.NewQuotaGroup(cfg.GetShadowQuotas())
+		if err != nil {
+			return nil, err
+		}
+
+		err = shadowQuotas.SetKeyQuotas(cfg.GetShadowKeyQuotas())
+		if err != nil {
+			return nil, err
+		}
+
+		shadow = limiter.NewShadow(shadowQuotas)
+	}
+
+	var scheduler queue.Scheduler = queue.NewQueue()
+	switch {
+	case cfg.FairQueue != nil && cfg.EarliestDeadlineFirst:
+		return nil, ErrConflictingQueues
+	case cfg.FairQueue != nil:
+		scheduler, err = queue.NewFairQueue(*cfg.FairQueue)
+		if err != nil {
+			return nil, err
+		}
+	case cfg.EarliestDeadlineFirst:
+		scheduler = queue.NewDeadlineQueue()
+	}
+
+	var emitter *events.Emitter
+	if cfg.Observer != nil {
+		emitter = events.NewEmitter(cfg.Observer, cfg.ObserverBuffer)
+	}
+
+	var logger *logging.Logger
+	if cfg.Logger != nil {
+		logger = logging.New(cfg.Logger, cfg.LogSampling.Burst, cfg.LogSampling.Interval)
+	}
+
 	l := &RateLimiter{
 		quotas:        quotas,
+		adaptive:      adaptiveLimiter,
+		breakers:      breakers,
+		shadow:        shadow,
+		events:        emitter,
+		logger:        logger,
+		flights:       newFlights(),
+		cache:         cache.NewCache(),
 		isRunningLock: &sync.Mutex{},
-		requests:      make(chan job.Request, cfg.Concurrency),
+		queue:         scheduler,
+		loadShedding:  cfg.LoadShedding,
+		requests:      make(chan job.Request),
 	}
 
-	l.init(cfg.Concurrency)
+	l.init(concurrency)
+
+	logger.Info("rate limiter configured",
+		slog.Any("quotas", cfg.GetQuotas()),
+		slog.Any("key_quotas", cfg.GetKeyQuotas()),
+		slog.Any("level_quotas", cfg.GetLevelQuotas()),
+		slog.Any("shadow_quotas", cfg.GetShadowQuotas()),
+		slog.Int("workers", int(concurrency)),
+		slog.Bool("adaptive", cfg.Adaptive != nil),
+		slog.Bool("circuit_breaker", cfg.CircuitBreaker != nil),
+		slog.Bool("fair_queue", cfg.FairQueue != nil),
+		slog.Bool("earliest_deadline_first", cfg.EarliestDeadlineFirst),
+		slog.Bool("load_shedding", cfg.LoadShedding),
+	)
 
 	return l, nil
 }
 
 func (l *RateLimiter) init(concurrency uint32) {
 	l.workers = make([]*worker.Worker, concurrency)
+	l.ready = make(chan struct{}, concurrency)
 
 	for i := uint32(0); i < concurrency; i++ {
+		l.ready <- struct{}{}
 		l.workers[i] = worker.NewWorker(l.quotas, l.requests, &l.wg)
+		l.workers[i].SetReady(l.ready)
+
+		if l.adaptive != nil {
+			l.workers[i].SetAdaptiveLimiter(l.adaptive)
+		}
+
+		if l.breakers != nil {
+			l.workers[i].SetCircuitBreakers(l.breakers)
+		}
+
+		if l.shadow != nil {
+			l.workers[i].SetShadow(l.shadow)
+		}
+
+		if l.events != nil {
+			l.workers[i].SetEmitter(l.events)
+		}
+
+		if l.logger != nil {
+			l.workers[i].SetLogger(l.logger)
+		}
 	}
 }
 
 func (l *RateLimiter) Execute(j job.Job) <-chan job.Response {
-	return l.ExecuteWithTimout(j, 0)
+	return l.ExecuteWithOptions(j)
 }
 
 func (l *RateLimiter) ExecuteWithTimout(j job.Job, timeout time.Duration) <-chan job.Response {
+	return l.ExecuteWithOptions(j, WithTimeout(timeout))
+}
+
+func (l *RateLimiter) ExecuteWithOptions(j job.Job, opts ...Option) <-chan job.Response {
+	return l.execute(job.Request{Job: j}, opts)
+}
+
+// ExecuteContext executes the job with the context. The job is failed with the context
+// error if the context is done before the job is started.
+func (l *RateLimiter) ExecuteContext(ctx context.Context, j job.ContextJob, opts ...Option) <-chan job.Response {
+	return l.execute(job.Request{ContextJob: j, Ctx: ctx}, opts)
+}
+
+func (l *RateLimiter) execute(r job.Request, opts []Option) <-chan job.Response {
 	l.wg.Add(1)
 
 	ch := make(chan job.Response)
+	r.Ch = ch
 
-	r := job.Request{
-		Job: j,
-		Ch:  ch,
+	for _, opt := range opts {
+		opt(&r)
 	}
 
-	if timeout > 0 {
-		r.ExpiredAt = time.Now().Add(timeout)
+	l.intercept(&r)
+
+	if l.breakers != nil && l.breakers.IsOpen(r.Key) {
+		l.reject(r, job.ErrCircuitOpen)
+
+		return ch
 	}
 
-	// add request to the queue channel in separated goroutine
-	// because the channel can be overload
-	go func(r job.Request) {
-		l.requests <- r
-	}(r)
+	if !l.fits(r) {
+		l.reject(r, job.ErrWeightExceedsCapacity)
+
+		return ch
+	}
+
+	if r.CacheKey != "" {
+		if l.fromCache(r) {
+			return ch
+		}
+
+		r = l.cacheResult(r)
+	}
+
+	if r.DedupKey != "" && l.share(&r) {
+		return ch
+	}
+
+	if l.loadShedding && l.shed(r, l.queue.Ahead(r)) {
+		return ch
+	}
+
+	l.push(r)
 
 	return ch
 }
 
+// Use registers interceptors which are run around every executed job in order.
+// Interceptors are applied to jobs submitted after the registration.
+func (l *RateLimiter) Use(interceptors ...job.Interceptor) {
+	l.interceptLock.Lock()
+	defer l.interceptLock.Unlock()
+
+	l.interceptors = append(l.interceptors, interceptors...)
+}
+
+// intercept puts interceptors of the limiter ahead of interceptors of the request
+func (l *RateLimiter) intercept(r *job.Request) {
+	l.interceptLock.RLock()
+	defer l.interceptLock.RUnlock()
+
+	if len(l.interceptors) == 0 {
+		return
+	}
+
+	interceptors := make([]job.Interceptor, 0, len(l.interceptors)+len(r.Interceptors))
+	interceptors = append(interceptors, l.interceptors...)
+	r.Interceptors = append(interceptors, r.Interceptors...)
+}
+
+// fits checks if the weight of the request doesn't exceed the capacity of quotas
+func (l *RateLimiter) fits(r job.Request) bool {
+	capacity := l.quotas.CapacityPath(r.Key, r.Path)
+
+	return capacity == 0 || r.Slots() <= capacity
+}
+
+func (l *RateLimiter) push(r job.Request) {
+	l.queue.Push(r)
+	l.events.Emit(event.Enqueued, r)
+	l.watchExpiry(r)
+}
+
+// pushFront puts the request ahead of the queue
+func (l *RateLimiter) pushFront(r job.Request) {
+	l.queue.PushFront(r)
+	l.events.Emit(event.Enqueued, r)
+	l.watchExpiry(r)
+}
+
+// watchExpiry fails the request if it's still in the queue at the time of expiry
+func (l *RateLimiter) watchExpiry(r job.Request) {
+	if !r.ExpiredAt.IsZero() {
+		time.AfterFunc(time.Until(r.ExpiredAt), func() {
+			l.expire(r)
+		})
+	}
+}
+
+// expire fails the request if it's still in the queue
+func (l *RateLimiter) expire(r job.Request) {
+	pos, ok := l.queue.Remove(r.Ch)
+	if !ok {
+		return
+	}
+
+	// the slot reserved before queueing wasn't used
+	if r.Reservation != nil {
+		r.Reservation.Refund()
+		r.Reservation.Release()
+	}
+
+	atomic.AddInt64(&l.expired, 1)
+
+	err := &job.ExpiredError{QueuePosition: pos}
+	l.events.Emit(event.Expired, r, events.WithErr(err))
+	l.logger.Sampled(slog.LevelWarn, "job expired in queue", slog.String("key", r.Key), slog.Int("position", pos))
+
+	l.respond(r, job.Response{
+		Result: nil,
+		Error:  err,
+	})
+}
+
+// dispatch passes requests from the queue to workers till the stop channel is closed.
+// A request is taken from the queue only when a worker is free and the adaptive limit
+// allows to start it.
+func (l *RateLimiter) dispatch(stop <-chan struct{}) {
+	for {
+		if !l.queue.Wait(stop) {
+			return
+		}
+
+		select {
+		case <-l.ready:
+		case <-stop:
+			return
+		}
+
+		if l.adaptive != nil && !l.adaptive.Acquire(stop) {
+			l.ready <- struct{}{}
+			return
+		}
+
+		r, ok := l.queue.Pop()
+		if !ok {
+			// the request was expired meanwhile
+			l.cancelDispatch()
+			continue
+		}
+
+		// the wait of the request is predictable when it leaves the queue
+		if l.loadShedding && l.shed(r, 0) {
+			l.cancelDispatch()
+			continue
+		}
+
+		select {
+		case l.requests <- r:
+		case <-stop:
+			l.queue.PushFront(r)
+			l.cancelDispatch()
+			return
+		}
+	}
+}
+
+// cancelDispatch returns the worker and the slot of the adaptive limiter
+// taken for the request which wasn't dispatched
+func (l *RateLimiter) cancelDispatch() {
+	l.ready <- struct{}{}
+
+	if l.adaptive != nil {
+		l.adaptive.Cancel()
+	}
+}
+
 func (l *RateLimiter) Start() {
 	l.isRunningLock.Lock()
 	defer l.isRunningLock.Unlock()
 
-	if l.isRunning {
+	if l.isRunning || l.isClosed {
 		return
 	}
 
@@ -83,7 +397,12 @@ func (l *RateLimiter) Start() {
 		w.Start()
 	}
 
+	if !l.isPaused {
+		l.startDispatch()
+	}
+
 	l.isRunning = true
+	l.logger.Info("rate limiter started", slog.Int("workers", len(l.workers)))
 }
 
 func (l *RateLimiter) Stop() {
@@ -94,13 +413,105 @@ func (l *RateLimiter) Stop() {
 		return
 	}
 
+	if !l.isPaused {
+		l.stopDispatch()
+	}
+
 	for _, w := range l.workers {
 		w.Stop()
 	}
 
 	l.isRunning = false
+	l.logger.Info("rate limiter stopped", slog.Int("queued", l.queue.Len()))
+}
+
+// Close stops the rate limiter for good and finishes the delivery of events
+// to the observer. The limiter can't be started again.
+func (l *RateLimiter) Close() {
+	l.Stop()
+
+	l.isRunningLock.Lock()
+	defer l.isRunningLock.Unlock()
+
+	l.isClosed = true
+	l.events.Close()
+}
+
+// Pause stops passing queued jobs to workers. New jobs are still accepted and
+// queued jobs are still expired. Jobs taken by workers before the pause are
+// completed as usual.
+func (l *RateLimiter) Pause() {
+	l.isRunningLock.Lock()
+	defer l.isRunningLock.Unlock()
+
+	if l.isPaused {
+		return
+	}
+
+	if l.isRunning {
+		l.stopDispatch()
+	}
+
+	l.isPaused = true
+	l.logger.Info("rate limiter paused", slog.Int("queued", l.queue.Len()))
+}
+
+// Resume continues processing of queued jobs after the pause
+func (l *RateLimiter) Resume() {
+	l.isRunningLock.Lock()
+	defer l.isRunningLock.Unlock()
+
+	if !l.isPaused {
+		return
+	}
+
+	if l.isRunning {
+		l.startDispatch()
+	}
+
+	l.isPaused = false
+	l.logger.Info("rate limiter resumed", slog.Int("queued", l.queue.Len()))
+}
+
+func (l *RateLimiter) IsPaused() bool {
+	l.isRunningLock.Lock()
+	defer l.isRunningLock.Unlock()
+
+	return l.isPaused
+}
+
+func (l *RateLimiter) startDispatch() {
+	l.stop = make(chan struct{})
+	go l.dispatch(l.stop)
+}
+
+func (l *RateLimiter) stopDispatch() {
+	close(l.stop)
 }
 
 func (l *RateLimiter) AwaitAll() {
 	l.wg.Wait()
 }
+
+// reject responds with the error without passing the request to workers
+func (l *RateLimiter) reject(r job.Request, err error) {
+	atomic.AddInt64(&l.rejected, 1)
+	l.events.Emit(event.Rejected, r, events.WithErr(err))
+	l.logger.Sampled(slog.LevelWarn, "job rejected", slog.String("key", r.Key), slog.Any("error", err))
+
+	l.respond(r, job.Response{
+		Result: nil,
+		Error:  err,
+	})
+}
+
+// respond sends the response without passing the request to workers
+func (l *RateLimiter) respond(r job.Request, resp job.Response) {
+	go func() {
+		r.Ch <- resp
+
+		close(r.Ch)
+
+		l.wg.Done()
+	}()
+}
@@ -1,13 +1,19 @@
 package limiter
 
 import (
+	"context"
+	"errors"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 
+	"github.com/chatex-com/rate-limiter/internal/adaptive"
+	"github.com/chatex-com/rate-limiter/internal/breaker"
 	"github.com/chatex-com/rate-limiter/internal/limiter"
+	"github.com/chatex-com/rate-limiter/internal/queue"
 	"github.com/chatex-com/rate-limiter/pkg/config"
 	"github.com/chatex-com/rate-limiter/pkg/job"
 )
@@ -23,6 +29,70 @@ func TestNewRateLimiter(t *testing.T) {
 		So(l.workers, ShouldHaveLength, 5)
 	})
 
+	Convey("wrong key quotas configuration", t, func() {
+		cfg := config.NewConfig()
+		cfg.AddKeyQuota(config.NewQuota(1, 0))
+		l, err := NewRateLimiter(cfg)
+
+		So(err, ShouldEqual, limiter.ErrZeroRuleInterval)
+		So(l, ShouldBeNil)
+	})
+
+	Convey("wrong level quotas configuration", t, func() {
+		cfg := config.NewConfig()
+		cfg.AddLevelQuota(1, config.NewQuota(1, 0))
+		l, err := NewRateLimiter(cfg)
+
+		So(err, ShouldEqual, limiter.ErrZeroRuleInterval)
+		So(l, ShouldBeNil)
+	})
+
+	Convey("wrong fair queue configuration", t, func() {
+		cfg := config.NewConfig()
+		cfg.FairQueue = config.NewFairQueue().SetWeight("foo", 0)
+		l, err := NewRateLimiter(cfg)
+
+		So(err, ShouldEqual, queue.ErrZeroTenantWeight)
+		So(l, ShouldBeNil)
+	})
+
+	Convey("conflicting queues configuration", t, func() {
+		cfg := config.NewConfig()
+		cfg.FairQueue = config.NewFairQueue()
+		cfg.EarliestDeadlineFirst = true
+		l, err := NewRateLimiter(cfg)
+
+		So(err, ShouldEqual, ErrConflictingQueues)
+		So(l, ShouldBeNil)
+	})
+
+	Convey("wrong shadow quotas configuration", t, func() {
+		cfg := config.NewConfig()
+		cfg.AddShadowKeyQuota(config.NewQuota(0, time.Second))
+		l, err := NewRateLimiter(cfg)
+
+		So(err, ShouldEqual, limiter.ErrZeroRuleCount)
+		So(l, ShouldBeNil)
+	})
+
+	Convey("wrong adaptive configuration", t, func() {
+		cfg := config.NewConfig()
+		cfg.Adaptive = config.NewAdaptive(0, 10, time.Second)
+		l, err := NewRateLimiter(cfg)
+
+		So(err, ShouldEqual, adaptive.ErrWrongBounds)
+		So(l, ShouldBeNil)
+	})
+
+	Convey("wrong circuit breaker configuration", t, func() {
+		cfg := config.NewConfig()
+		cfg.CircuitBreaker = config.NewCircuitBreaker(1, 0)
+		l, err := NewRateLimiter(cfg)
+
+		So(err, ShouldEqual, breaker.ErrZeroOpenTimeout)
+		So(l, ShouldBeNil)
+	})
+
 	Convey("wrong configuration", t, func() {
 		cfg := config.NewConfig()
 		cfg.AddQuota(config.NewQuota(0, 0))
@@ -65,6 +135,75 @@ func TestRateLimiter_Execute(t *testing.T) {
 		So(resp.Result, ShouldEqual, "foo")
 	})
 
+	Convey("job execution with key", t, func() {
+		cfg := config.NewConfig()
+		cfg.Concurrency = 2
+		cfg.AddKeyQuota(config.NewQuota(1, time.Hour))
+		l, _ := NewRateLimiter(cfg)
+		l.Start()
+
+		resp := <-l.ExecuteWithOptions(func() (interface{}, error) {
+			return "foo", nil
+		}, WithKey("foo"))
+		So(resp.Error, ShouldBeNil)
+
+		resp = <-l.ExecuteWithOptions(func() (interface{}, error) {
+			return "bar", nil
+		}, WithKey("bar"))
+		So(resp.Error, ShouldBeNil)
+
+		resp = <-l.ExecuteWithOptions(func() (interface{}, error) {
+			return "foo", nil
+		}, WithKey("foo"), WithTimeout(10*time.Millisecond))
+		So(errors.Is(resp.Error, job.ErrJobExpired), ShouldBeTrue)
+	})
+
+	Convey("job execution with path", t, func() {
+		cfg := config.NewConfig()
+		cfg.Concurrency = 2
+		cfg.AddLevelQuota(0, config.NewQuota(2, time.Hour))
+		cfg.AddLevelQuota(1, config.NewQuota(1, time.Hour))
+		l, _ := NewRateLimiter(cfg)
+		l.Start()
+
+		resp := <-l.ExecuteWithOptions(func() (interface{}, error) {
+			return "foo", nil
+		}, WithPath("account", "foo"))
+		So(resp.Error, ShouldBeNil)
+
+		resp = <-l.ExecuteWithOptions(func() (interface{}, error) {
+			return "foo", nil
+		}, WithPath("account", "foo"), WithTimeout(10*time.Millisecond))
+		So(errors.Is(resp.Error, job.ErrJobExpired), ShouldBeTrue)
+
+		resp = <-l.ExecuteWithOptions(func() (interface{}, error) {
+			return "bar", nil
+		}, WithPath("account", "bar"))
+		So(resp.Error, ShouldBeNil)
+	})
+
+	Convey("job execution with context", t, func() {
+		cfg := config.NewConfig()
+		cfg.Concurrency = 1
+		cfg.AddQuota(config.NewQuota(1, time.Hour))
+		l, _ := NewRateLimiter(cfg)
+		l.Start()
+
+		resp := <-l.ExecuteContext(context.Background(), func(ctx context.Context) (interface{}, error) {
+			return "foo", nil
+		})
+		So(resp.Error, ShouldBeNil)
+		So(resp.Result, ShouldEqual, "foo")
+
+		// the job is waiting for a free slot till the context is done
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		resp = <-l.ExecuteContext(ctx, func(ctx context.Context) (interface{}, error) {
+			return "bar", nil
+		})
+		So(errors.Is(resp.Error, context.DeadlineExceeded), ShouldBeTrue)
+	})
+
 	Convey("error job execution", t, func() {
 		cfg := config.NewConfig()
 		cfg.Concurrency = 1
@@ -82,6 +221,59 @@ func TestRateLimiter_Execute(t *testing.T) {
 	})
 }
 
+func TestExpireInQueue(t *testing.T) {
+	Convey("Job is expired with its queue position", t, func() {
+		cfg := config.NewConfig()
+		cfg.Concurrency = 1
+		l, _ := NewRateLimiter(cfg)
+
+		noop := func() (interface{}, error) {
+			return nil, nil
+		}
+		l.Execute(noop)
+		l.Execute(noop)
+		ch := l.ExecuteWithTimout(noop, 10*time.Millisecond)
+
+		resp := <-ch
+
+		var expiredErr *job.ExpiredError
+		So(errors.As(resp.Error, &expiredErr), ShouldBeTrue)
+		So(errors.Is(resp.Error, job.ErrJobExpired), ShouldBeTrue)
+		So(expiredErr.QueuePosition, ShouldEqual, 3)
+		So(l.Stat().ExpiredInQueue, ShouldEqual, 1)
+		So(l.queue.Len(), ShouldEqual, 2)
+	})
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	Convey("New jobs fail fast when circuit breaker is open", t, func() {
+		cfg := config.NewConfig()
+		cfg.Concurrency = 1
+		cfg.CircuitBreaker = config.NewCircuitBreaker(1, time.Hour)
+		l, _ := NewRateLimiter(cfg)
+		l.Start()
+
+		resp := <-l.Execute(func() (interface{}, error) {
+			return nil, errors.New("upstream is down")
+		})
+		So(resp.Error, ShouldBeError)
+
+		resp = <-l.Execute(func() (interface{}, error) {
+			return "foo", nil
+		})
+		So(resp.Error, ShouldEqual, job.ErrCircuitOpen)
+
+		// the breaker of the limiter is applied to keyed jobs too
+		resp = <-l.ExecuteWithOptions(func() (interface{}, error) {
+			return "foo", nil
+		}, WithKey("foo"))
+		So(resp.Error, ShouldEqual, job.ErrCircuitOpen)
+
+		l.AwaitAll()
+		So(l.Stat().Rejected, ShouldEqual, 2)
+	})
+}
+
 func TestStartStop(t *testing.T) {
 	Convey("Start(), Stop() all workers", t, func() {
 		cfg := config.NewConfig()
@@ -147,3 +339,169 @@ func TestAwaitAll(t *testing.T) {
 		So(res.Result, ShouldBeTrue)
 	})
 }
+
+func TestPauseResume(t *testing.T) {
+	Convey("Queued jobs are kept while the limiter is paused", t, func() {
+		cfg := config.NewConfig()
+		cfg.Concurrency = 1
+		l, _ := NewRateLimiter(cfg)
+		l.Start()
+
+		l.Pause()
+		l.Pause()
+		So(l.IsPaused(), ShouldBeTrue)
+		So(l.workers[0].IsRunning(), ShouldBeTrue)
+
+		ch := l.Execute(func() (interface{}, error) {
+			return "foo", nil
+		})
+		expired := l.ExecuteWithTimout(func() (interface{}, error) {
+			return "bar", nil
+		}, 10*time.Millisecond)
+
+		So(errors.Is((<-expired).Error, job.ErrJobExpired), ShouldBeTrue)
+
+		select {
+		case <-ch:
+			So("the job is executed while paused", ShouldBeEmpty)
+		case <-time.After(20 * time.Millisecond):
+		}
+		So(l.queue.Len(), ShouldEqual, 1)
+
+		l.Resume()
+		l.Resume()
+		So(l.IsPaused(), ShouldBeFalse)
+
+		resp := <-ch
+		So(resp.Error, ShouldBeNil)
+		So(resp.Result, ShouldEqual, "foo")
+	})
+
+	Convey("Jobs over the adaptive limit are kept in the queue", t, func() {
+		cfg := config.NewConfig()
+		cfg.Adaptive = config.NewAdaptive(1, 10, time.Second)
+		l, _ := NewRateLimiter(cfg)
+		l.Start()
+
+		finish := make(chan struct{})
+		first := l.Execute(func() (interface{}, error) {
+			<-finish
+			return nil, nil
+		})
+
+		var started int32
+		chs := make([]<-chan job.Response, 5)
+		for i := range chs {
+			chs[i] = l.Execute(func() (interface{}, error) {
+				atomic.AddInt32(&started, 1)
+				return nil, nil
+			})
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		So(l.queue.Len(), ShouldEqual, 5)
+
+		pos, ok := l.QueuePosition(chs[0])
+		So(ok, ShouldBeTrue)
+		So(pos, ShouldEqual, 1)
+
+		l.Pause()
+		close(finish)
+		<-first
+
+		time.Sleep(10 * time.Millisecond)
+		So(atomic.LoadInt32(&started), ShouldEqual, 0)
+		So(l.queue.Len(), ShouldEqual, 5)
+
+		l.Resume()
+		for _, ch := range chs {
+			So((<-ch).Error, ShouldBeNil)
+		}
+		So(atomic.LoadInt32(&started), ShouldEqual, 5)
+	})
+
+	Convey("Paused limiter is started without processing", t, func() {
+		cfg := config.NewConfig()
+		cfg.Concurrency = 1
+		l, _ := NewRateLimiter(cfg)
+
+		l.Pause()
+		l.Start()
+		ch := l.Execute(func() (interface{}, error) {
+			return "foo", nil
+		})
+
+		time.Sleep(10 * time.Millisecond)
+		So(l.queue.Len(), ShouldEqual, 1)
+
+		l.Stop()
+		l.Resume()
+		So(l.queue.Len(), ShouldEqual, 1)
+
+		l.Start()
+		So((<-ch).Result, ShouldEqual, "foo")
+	})
+}
+
+func TestFairQueue(t *testing.T) {
+	Convey("Jobs of tenants are dispatched in fair order", t, func() {
+		cfg := config.NewConfig()
+		cfg.Concurrency = 1
+		cfg.FairQueue = config.NewFairQueue()
+		l, _ := NewRateLimiter(cfg)
+
+		noop := func() (interface{}, error) {
+			return nil, nil
+		}
+		ch1 := l.ExecuteWithOptions(noop, WithTenant("noisy"))
+		ch2 := l.ExecuteWithOptions(noop, WithTenant("noisy"))
+		ch3 := l.ExecuteWithOptions(noop, WithTenant("foo"))
+
+		pos, ok := l.QueuePosition(ch3)
+		So(ok, ShouldBeTrue)
+		So(pos, ShouldEqual, 2)
+
+		So(l.Stat().Tenants, ShouldResemble, map[string]TenantStat{
+			"noisy": {Weight: 1, Queued: 2, Dispatched: 0},
+			"foo":   {Weight: 1, Queued: 1, Dispatched: 0},
+		})
+
+		l.Start()
+		<-ch1
+		<-ch3
+		<-ch2
+
+		So(l.Stat().Tenants, ShouldResemble, map[string]TenantStat{
+			"noisy": {Weight: 1, Queued: 0, Dispatched: 2},
+			"foo":   {Weight: 1, Queued: 0, Dispatched: 1},
+		})
+	})
+}
+
+func TestEarliestDeadlineFirst(t *testing.T) {
+	Convey("Jobs are dispatched in deadline order", t, func() {
+		cfg := config.NewConfig()
+		cfg.Concurrency = 1
+		cfg.EarliestDeadlineFirst = true
+		l, _ := NewRateLimiter(cfg)
+
+		noop := func() (interface{}, error) {
+			return nil, nil
+		}
+		ch1 := l.Execute(noop)
+		ch2 := l.ExecuteWithTimout(noop, time.Hour)
+		ch3 := l.ExecuteWithTimout(noop, time.Minute)
+
+		pos, _ := l.QueuePosition(ch3)
+		So(pos, ShouldEqual, 1)
+		pos, _ = l.QueuePosition(ch1)
+		So(pos, ShouldEqual, 3)
+
+		l.Start()
+		<-ch3
+		<-ch2
+		<-ch1
+
+		So(l.Stat().SavedByDeadline, ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,41 @@
+package limiter
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+// shed fails the request if it can't be started before its deadline. The start time
+// is estimated by slots of requests taken by workers and of requests dispatched ahead
+// of it for sure, so the request is shed only if its deadline can't be met for sure.
+// It returns false if the deadline can be met.
+func (l *RateLimiter) shed(r job.Request, ahead uint) bool {
+	if r.ExpiredAt.IsZero() {
+		return false
+	}
+
+	for _, w := range l.workers {
+		if waiting, ok := w.Waiting(); ok {
+			ahead += waiting.Request.Slots()
+		}
+	}
+
+	wait := l.quotas.MinWait(ahead + r.Slots())
+	if !time.Now().Add(wait).After(r.ExpiredAt) {
+		return false
+	}
+
+	// the slot booked for the request wasn't used
+	if r.Reservation != nil {
+		r.Reservation.Refund()
+		r.Reservation.Release()
+	}
+
+	atomic.AddInt64(&l.shedCount, 1)
+
+	l.reject(r, &job.WouldExpireError{Wait: wait, Deadline: r.ExpiredAt})
+
+	return true
+}
@@ -0,0 +1,108 @@
+package limiter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/chatex-com/rate-limiter/pkg/config"
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+func TestLoadShedding(t *testing.T) {
+	Convey("Jobs which would expire are failed on submission", t, func() {
+		cfg := config.NewConfigWithQuotas([]*config.Quota{
+			config.NewQuota(1, time.Hour),
+		})
+		cfg.Concurrency = 1
+		cfg.LoadShedding = true
+		l, _ := NewRateLimiter(cfg)
+		l.Start()
+
+		resp := <-l.Execute(func() (interface{}, error) {
+			return "foo", nil
+		})
+		So(resp.Error, ShouldBeNil)
+
+		start := time.Now()
+		resp = <-l.ExecuteWithTimout(func() (interface{}, error) {
+			return "bar", nil
+		}, time.Minute)
+		So(time.Since(start), ShouldBeLessThan, time.Second)
+
+		var wouldExpireErr *job.WouldExpireError
+		So(errors.Is(resp.Error, job.ErrWouldExpire), ShouldBeTrue)
+		So(errors.As(resp.Error, &wouldExpireErr), ShouldBeTrue)
+		So(wouldExpireErr.Wait, ShouldAlmostEqual, time.Hour, time.Second)
+
+		// the deadline can be met
+		ch := l.ExecuteWithTimout(func() (interface{}, error) {
+			return "baz", nil
+		}, 2*time.Hour)
+		select {
+		case <-ch:
+			So("the job is failed", ShouldBeEmpty)
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		So(l.Stat().Shed, ShouldEqual, 1)
+		So(l.Stat().Rejected, ShouldEqual, 1)
+	})
+
+	Convey("Jobs which would expire are failed on dequeue", t, func() {
+		cfg := config.NewConfigWithQuotas([]*config.Quota{
+			config.NewQuota(2, time.Hour),
+		})
+		cfg.Concurrency = 1
+		cfg.EarliestDeadlineFirst = true
+		cfg.LoadShedding = true
+		l, _ := NewRateLimiter(cfg)
+		l.Start()
+
+		slow := l.Execute(func() (interface{}, error) {
+			time.Sleep(50 * time.Millisecond)
+			return nil, nil
+		})
+		time.Sleep(10 * time.Millisecond)
+
+		noop := func() (interface{}, error) {
+			return nil, nil
+		}
+		// a free slot is left for one of the queued jobs
+		late := l.ExecuteWithTimout(noop, time.Minute)
+		early := l.ExecuteWithTimout(noop, 30*time.Second)
+		So(l.Stat().Shed, ShouldEqual, 0)
+
+		<-slow
+		So((<-early).Error, ShouldBeNil)
+
+		resp := <-late
+		So(errors.Is(resp.Error, job.ErrWouldExpire), ShouldBeTrue)
+		So(l.Stat().Shed, ShouldEqual, 1)
+	})
+
+	Convey("Shedding doesn't slow down submission", t, func() {
+		for _, fair := range []bool{false, true} {
+			cfg := config.NewConfigWithQuotas([]*config.Quota{
+				config.NewQuota(100, time.Second),
+			})
+			cfg.LoadShedding = true
+			if fair {
+				cfg.FairQueue = config.NewFairQueue()
+			}
+			l, _ := NewRateLimiter(cfg)
+
+			start := time.Now()
+			for i := 0; i < 5000; i++ {
+				l.ExecuteWithOptions(func() (interface{}, error) {
+					return nil, nil
+				}, WithTimeout(time.Hour), WithTenant(string(rune('a'+i%10))))
+			}
+
+			So(time.Since(start), ShouldBeLessThan, time.Second)
+			So(l.Stat().Shed, ShouldEqual, 0)
+		}
+	})
+}
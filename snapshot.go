@@ -0,0 +1,55 @@
+package limiter
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+
+	"github.com/chatex-com/rate-limiter/internal/limiter"
+)
+
+// Snapshot serializes usage of time window quotas, so a new process can be
+// started with Restore without bursting past limits of the upstream
+func (l *RateLimiter) Snapshot() ([]byte, error) {
+	return json.Marshal(l.quotas.Snapshot())
+}
+
+// Restore adds taken slots of the snapshot to quotas with the same interval.
+// Slots released since the snapshot was taken are skipped.
+func (l *RateLimiter) Restore(data []byte) error {
+	var state limiter.State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	l.quotas.Restore(state)
+	l.logger.Info("quota usage restored", slog.Int("keys", len(state.Keys)), slog.Int("paths", len(state.Paths)))
+
+	return nil
+}
+
+// SaveSnapshot writes the snapshot to the file
+func (l *RateLimiter) SaveSnapshot(path string) error {
+	data, err := l.Snapshot()
+	if err != nil {
+		return err
+	}
+
+	// the previous snapshot is replaced only if the new one is written completely
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// RestoreSnapshot restores usage of quotas from the file
+func (l *RateLimiter) RestoreSnapshot(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return l.Restore(data)
+}
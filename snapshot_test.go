@@ -0,0 +1,40 @@
+package limiter
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/chatex-com/rate-limiter/pkg/config"
+)
+
+func TestSnapshot(t *testing.T) {
+	Convey("New limiter resumes with usage of the previous one", t, func() {
+		cfg := config.NewConfigWithQuotas([]*config.Quota{
+			config.NewQuota(1, time.Hour),
+		})
+		l, _ := NewRateLimiter(cfg)
+		l.Start()
+
+		resp := <-l.Execute(func() (interface{}, error) {
+			return nil, nil
+		})
+		So(resp.Error, ShouldBeNil)
+
+		path := filepath.Join(t.TempDir(), "quotas.json")
+		So(l.SaveSnapshot(path), ShouldBeNil)
+
+		restored, _ := NewRateLimiter(cfg)
+		So(restored.RestoreSnapshot(path), ShouldBeNil)
+
+		_, err := restored.TryExecute(func() (interface{}, error) {
+			return nil, nil
+		})
+		So(err, ShouldBeError)
+
+		So(restored.Restore([]byte("{")), ShouldBeError)
+		So(restored.RestoreSnapshot(filepath.Join(t.TempDir(), "missing.json")), ShouldBeError)
+	})
+}
@@ -0,0 +1,107 @@
+package limiter
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/chatex-com/rate-limiter/internal/queue"
+)
+
+// Stat is a snapshot of the rate limiter counters
+type Stat struct {
+	InProcess int64
+	Error     int64
+	Done      int64
+	Refunded  int64
+	// Rejected is the number of jobs failed on submission (e.g. circuit breaker is open)
+	Rejected int64
+	// ExpiredInQueue is the number of jobs expired before they were taken by a worker
+	ExpiredInQueue int64
+	// Shed is the number of jobs failed on submission because they would expire in the queue
+	Shed int64
+	// Deduplicated is the number of jobs shared with the job in progress
+	Deduplicated int64
+	CacheHits    int64
+	CacheMisses  int64
+	// CacheStale is the number of stale responses served when quota is exhausted
+	CacheStale int64
+	// ConcurrencyLimit is the current limit of jobs in flight
+	ConcurrencyLimit uint32
+	// SavedByDeadline estimates the number of jobs which would have been expired in FIFO order
+	// if earliest deadline first is enabled
+	SavedByDeadline int64
+	// Shadow are counters of shadow quotas if they are configured
+	Shadow ShadowStat
+	// EventsDropped is the number of lifecycle events dropped because the observer is slow
+	EventsDropped int64
+	// ObserverPanics is the number of recovered panics of the observer
+	ObserverPanics int64
+	// Tenants are counters of every tenant with a job within the last hour if fair queuing is enabled
+	Tenants map[string]TenantStat
+}
+
+// ShadowStat reports what shadow quotas would do with executed jobs
+type ShadowStat struct {
+	// Accepted is the number of jobs which would get a slot immediately
+	Accepted int64
+	// Delayed is the number of jobs which would wait for a slot
+	Delayed int64
+	// Expired is the number of jobs which would be expired on waiting for a slot
+	Expired int64
+	// Delay is the total duration of waits of delayed jobs
+	Delay time.Duration
+}
+
+// TenantStat is a snapshot of the tenant counters of the fair queue
+type TenantStat struct {
+	Weight uint
+	// Queued is the number of jobs waiting in the queue
+	Queued int
+	// Dispatched is the number of jobs passed to workers
+	Dispatched int64
+}
+
+func (l *RateLimiter) Stat() Stat {
+	stat := Stat{
+		Rejected:       atomic.LoadInt64(&l.rejected),
+		ExpiredInQueue: atomic.LoadInt64(&l.expired),
+		Shed:           atomic.LoadInt64(&l.shedCount),
+		Deduplicated:   atomic.LoadInt64(&l.deduplicated),
+		CacheHits:      l.cache.Hits(),
+		CacheMisses:    l.cache.Misses(),
+		CacheStale:     l.cache.Stale(),
+		EventsDropped:  l.events.Dropped(),
+		ObserverPanics: l.events.Panics(),
+	}
+
+	for _, w := range l.workers {
+		s := w.Stat()
+		stat.InProcess += s.InProcess
+		stat.Error += s.Error
+		stat.Done += s.Done
+		stat.Refunded += s.Refunded
+	}
+
+	if l.adaptive != nil {
+		stat.ConcurrencyLimit = l.adaptive.Limit()
+	} else {
+		stat.ConcurrencyLimit = uint32(len(l.workers))
+	}
+
+	if l.shadow != nil {
+		stat.Shadow = ShadowStat(l.shadow.Stat())
+	}
+
+	if edf, ok := l.queue.(*queue.DeadlineQueue); ok {
+		stat.SavedByDeadline = edf.Saved()
+	}
+
+	if fair, ok := l.queue.(*queue.FairQueue); ok {
+		stat.Tenants = make(map[string]TenantStat)
+		for name, s := range fair.Stat() {
+			stat.Tenants[name] = TenantStat(s)
+		}
+	}
+
+	return stat
+}
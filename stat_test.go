@@ -0,0 +1,77 @@
+package limiter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/chatex-com/rate-limiter/pkg/config"
+)
+
+func TestStat(t *testing.T) {
+	Convey("Static concurrency", t, func() {
+		cfg := config.NewConfig()
+		cfg.Concurrency = 2
+		l, _ := NewRateLimiter(cfg)
+		l.Start()
+
+		<-l.Execute(func() (interface{}, error) {
+			return nil, nil
+		})
+		<-l.Execute(func() (interface{}, error) {
+			return nil, errors.New("error")
+		})
+		l.AwaitAll()
+
+		stat := l.Stat()
+		So(stat.Done, ShouldEqual, 1)
+		So(stat.Error, ShouldEqual, 1)
+		So(stat.InProcess, ShouldEqual, 0)
+		So(stat.ConcurrencyLimit, ShouldEqual, 2)
+	})
+
+	Convey("Adaptive concurrency", t, func() {
+		cfg := config.NewConfig()
+		cfg.Adaptive = config.NewAdaptive(1, 2, time.Second)
+		l, _ := NewRateLimiter(cfg)
+		l.Start()
+
+		So(l.workers, ShouldHaveLength, 2)
+		So(l.Stat().ConcurrencyLimit, ShouldEqual, 1)
+
+		for i := 0; i < 3; i++ {
+			<-l.Execute(func() (interface{}, error) {
+				return nil, nil
+			})
+		}
+		l.AwaitAll()
+
+		So(l.Stat().ConcurrencyLimit, ShouldEqual, 2)
+	})
+}
+
+func TestShadowStat(t *testing.T) {
+	Convey("Shadow quotas never delay jobs", t, func() {
+		cfg := config.NewConfig()
+		cfg.Concurrency = 1
+		cfg.AddShadowQuota(config.NewQuota(1, time.Hour))
+		cfg.AddShadowKeyQuota(config.NewQuota(1, time.Hour))
+		l, _ := NewRateLimiter(cfg)
+		l.Start()
+
+		noop := func() (interface{}, error) {
+			return nil, nil
+		}
+		So((<-l.ExecuteWithOptions(noop, WithKey("foo"))).Error, ShouldBeNil)
+		So((<-l.ExecuteWithOptions(noop, WithKey("bar"))).Error, ShouldBeNil)
+		So((<-l.ExecuteWithOptions(noop, WithTimeout(time.Minute))).Error, ShouldBeNil)
+
+		stat := l.Stat().Shadow
+		So(stat.Accepted, ShouldEqual, 1)
+		So(stat.Delayed, ShouldEqual, 1)
+		So(stat.Expired, ShouldEqual, 1)
+		So(stat.Delay, ShouldAlmostEqual, time.Hour, time.Second)
+	})
+}
@@ -0,0 +1,83 @@
+package limiter
+
+import (
+	"log/slog"
+	"sync/atomic"
+
+	"github.com/chatex-com/rate-limiter/internal/events"
+	"github.com/chatex-com/rate-limiter/pkg/event"
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+// TryExecute reserves a slot synchronously and passes the job straight to a free worker,
+// so the job is started at the time of the reservation. It fails immediately with
+// *job.RateLimitError if any quota is exhausted or no worker is free (e.g. the limiter
+// is paused). Cache and deduplication options are not applied.
+func (l *RateLimiter) TryExecute(j job.Job, opts ...Option) (<-chan job.Response, error) {
+	r := job.Request{Job: j}
+
+	for _, opt := range opts {
+		opt(&r)
+	}
+
+	l.intercept(&r)
+
+	if l.breakers != nil && l.breakers.IsOpen(r.Key) {
+		return nil, l.rejectSync(r, job.ErrCircuitOpen)
+	}
+
+	if !l.fits(r) {
+		return nil, l.rejectSync(r, job.ErrWeightExceedsCapacity)
+	}
+
+	if !l.isProcessing() {
+		return nil, l.rejectSync(r, &job.RateLimitError{})
+	}
+
+	// the job is started only by a free worker
+	select {
+	case <-l.ready:
+	default:
+		return nil, l.rejectSync(r, &job.RateLimitError{})
+	}
+
+	if l.adaptive != nil && !l.adaptive.TryAcquire() {
+		l.ready <- struct{}{}
+
+		return nil, l.rejectSync(r, &job.RateLimitError{})
+	}
+
+	reservation, wait, exhausted := l.quotas.ReservePath(r.Key, r.Path, r.Slots())
+	if reservation == nil {
+		l.cancelDispatch()
+
+		return nil, l.rejectSync(r, &job.RateLimitError{Wait: wait, Quotas: exhausted})
+	}
+
+	l.wg.Add(1)
+
+	ch := make(chan job.Response)
+	r.Ch = ch
+	r.Reservation = reservation
+
+	l.requests <- r
+
+	return ch, nil
+}
+
+// isProcessing checks if workers are started and the limiter isn't paused
+func (l *RateLimiter) isProcessing() bool {
+	l.isRunningLock.Lock()
+	defer l.isRunningLock.Unlock()
+
+	return l.isRunning && !l.isPaused
+}
+
+// rejectSync counts the request failed on submission and returns the error
+func (l *RateLimiter) rejectSync(r job.Request, err error) error {
+	atomic.AddInt64(&l.rejected, 1)
+	l.events.Emit(event.Rejected, r, events.WithErr(err))
+	l.logger.Sampled(slog.LevelWarn, "job rejected", slog.String("key", r.Key), slog.Any("error", err))
+
+	return err
+}
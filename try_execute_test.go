@@ -0,0 +1,93 @@
+package limiter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/chatex-com/rate-limiter/pkg/config"
+	"github.com/chatex-com/rate-limiter/pkg/job"
+)
+
+func TestTryExecute(t *testing.T) {
+	Convey("Fail fast when quota is exhausted", t, func() {
+		cfg := config.NewConfigWithQuotas([]*config.Quota{
+			config.NewQuota(1, time.Second),
+		})
+		l, _ := NewRateLimiter(cfg)
+		l.Start()
+
+		ch, err := l.TryExecute(func() (interface{}, error) {
+			return "foo", nil
+		})
+		So(err, ShouldBeNil)
+		So((<-ch).Result, ShouldEqual, "foo")
+
+		ch, err = l.TryExecute(func() (interface{}, error) {
+			return "bar", nil
+		})
+		So(ch, ShouldBeNil)
+		So(errors.Is(err, job.ErrRateLimited), ShouldBeTrue)
+
+		var rateLimitErr *job.RateLimitError
+		So(errors.As(err, &rateLimitErr), ShouldBeTrue)
+		So(rateLimitErr.Wait, ShouldAlmostEqual, time.Second, 10*time.Millisecond)
+		So(l.Stat().Rejected, ShouldEqual, 1)
+	})
+
+	Convey("Fail fast when no worker is free", t, func() {
+		cfg := config.NewConfig()
+		cfg.Concurrency = 1
+		cfg.AddKeyQuota(config.NewQuota(1, 200*time.Millisecond))
+		l, _ := NewRateLimiter(cfg)
+
+		noop := func() (interface{}, error) {
+			return nil, nil
+		}
+
+		// the limiter isn't started
+		_, err := l.TryExecute(noop, WithKey("B"))
+		So(errors.Is(err, job.ErrRateLimited), ShouldBeTrue)
+
+		l.Start()
+		finish := make(chan struct{})
+		slow := l.ExecuteWithOptions(func() (interface{}, error) {
+			<-finish
+			return nil, nil
+		}, WithKey("A"))
+		time.Sleep(5 * time.Millisecond)
+
+		_, err = l.TryExecute(noop, WithKey("B"))
+		So(errors.Is(err, job.ErrRateLimited), ShouldBeTrue)
+
+		var rateLimitErr *job.RateLimitError
+		So(errors.As(err, &rateLimitErr), ShouldBeTrue)
+		So(rateLimitErr.Quotas, ShouldBeEmpty)
+
+		close(finish)
+		<-slow
+		time.Sleep(5 * time.Millisecond)
+
+		// the slot wasn't taken by failed attempts
+		ch, err := l.TryExecute(noop, WithKey("B"))
+		So(err, ShouldBeNil)
+		So((<-ch).Error, ShouldBeNil)
+		So(l.Stat().Rejected, ShouldEqual, 2)
+	})
+
+	Convey("Job isn't started while the limiter is paused", t, func() {
+		l, _ := NewRateLimiter(config.NewConfig())
+		l.Start()
+		l.Pause()
+
+		_, err := l.TryExecute(func() (interface{}, error) {
+			return nil, nil
+		})
+		So(errors.Is(err, job.ErrRateLimited), ShouldBeTrue)
+
+		free, _ := l.quotas.ReserveFreeSlot()
+		So(free, ShouldBeTrue)
+	})
+}